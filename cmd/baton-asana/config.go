@@ -2,7 +2,9 @@ package main
 
 import (
 	"errors"
+	"fmt"
 
+	"github.com/conductorone/baton-asana/pkg/connector"
 	"github.com/conductorone/baton-sdk/pkg/field"
 	"github.com/spf13/viper"
 )
@@ -10,8 +12,78 @@ import (
 var (
 	TokenField = field.StringField(
 		"token",
-		field.WithRequired(true),
-		field.WithDescription("Your workato API key"),
+		field.WithDescription("The Asana personal access token used to connect to the Asana API"),
+	)
+	OAuthClientIDField = field.StringField(
+		"oauth-client-id",
+		field.WithDescription("The client ID of the Asana OAuth app used to connect to the Asana API"),
+	)
+	OAuthClientSecretField = field.StringField(
+		"oauth-client-secret",
+		field.WithDescription("The client secret of the Asana OAuth app used to connect to the Asana API"),
+	)
+	OAuthRefreshTokenField = field.StringField(
+		"oauth-refresh-token",
+		field.WithDescription("The refresh token issued to the Asana OAuth app, exchanged for access tokens as needed"),
+	)
+	PrefetchTeamMembershipsField = field.BoolField(
+		"prefetch-team-memberships",
+		field.WithDescription("Concurrently fetch the memberships of listed teams ahead of syncing their grants"),
+	)
+	PrefetchWorkersField = field.IntField(
+		"prefetch-workers",
+		field.WithDescription("The number of concurrent requests used to prefetch team memberships, at most 20"),
+		field.WithDefaultValue(10),
+	)
+	OffboardingField = field.BoolField(
+		"offboarding",
+		field.WithDescription("Transfer the projects, goals and incomplete tasks a user owns and share their portfolios with a successor before removing them from a workspace"),
+	)
+	OffboardingSuccessorField = field.StringField(
+		"offboarding-successor",
+		field.WithDescription("The gid or email of the user taking over from offboarded users, defaults to each user's manager"),
+	)
+	GuestAccessReportField = field.BoolField(
+		"guest-access-report",
+		field.WithDescription("Flag the team, project and portfolio grants of guests with guest metadata, using the workspace memberships synced with users"),
+	)
+	DormantAfterDaysField = field.IntField(
+		"dormant-after-days",
+		field.WithDescription("Flag workspace members who have not logged in for this many days as dormant, requires audit log access, 0 disables it"),
+	)
+	SensitiveProjectsField = field.StringSliceField(
+		"sensitive-projects",
+		field.WithDescription("The gids of projects whose tasks followed by users outside the project are synced"),
+	)
+	SensitiveTaskPageLimitField = field.IntField(
+		"sensitive-task-page-limit",
+		field.WithDescription("The number of pages of 100 tasks scanned per sensitive project"),
+		field.WithDefaultValue(connector.DefaultSensitiveTaskPageLimit),
+	)
+	OrganizationExportField = field.BoolField(
+		"organization-export",
+		field.WithDescription("Read users, teams and memberships of organizations from an organization export instead of paginating, requires an Enterprise service account"),
+	)
+	RecordField = field.StringField(
+		"record",
+		field.WithDescription("Record every request to Asana and its response to this cassette file, redacting credentials and the redact-fields"),
+	)
+	ReplayField = field.StringField(
+		"replay",
+		field.WithDescription("Serve every request from this cassette file recorded with --record instead of Asana, without any network access"),
+	)
+	RedactFieldsField = field.StringSliceField(
+		"redact-fields",
+		field.WithDescription("The JSON and form fields whose values are redacted from cassettes, on top of credentials"),
+		field.WithDefaultValue([]string{"email"}),
+	)
+	ResourceTypesField = field.StringSliceField(
+		"resource-types",
+		field.WithDescription("The resource types to sync, all by default: user, workspace, team, project, project_template, portfolio, custom_field and task. Every other type requires workspace, and task also requires project"),
+	)
+	SkipGrantsField = field.StringSliceField(
+		"skip-grants",
+		field.WithDescription("The resource types synced without their entitlements and grants"),
 	)
 
 	// ConfigurationFields defines the external configuration required for the
@@ -19,13 +91,36 @@ var (
 	// required.
 	ConfigurationFields = []field.SchemaField{
 		TokenField,
+		OAuthClientIDField,
+		OAuthClientSecretField,
+		OAuthRefreshTokenField,
+		PrefetchTeamMembershipsField,
+		PrefetchWorkersField,
+		OffboardingField,
+		OffboardingSuccessorField,
+		GuestAccessReportField,
+		DormantAfterDaysField,
+		SensitiveProjectsField,
+		SensitiveTaskPageLimitField,
+		OrganizationExportField,
+		RecordField,
+		ReplayField,
+		RedactFieldsField,
+		ResourceTypesField,
+		SkipGrantsField,
 	}
 
 	// FieldRelationships defines relationships between the fields listed in
 	// ConfigurationFields that can be automatically validated. For example, a
 	// username and password can be required together, or an access token can be
 	// marked as mutually exclusive from the username password pair.
-	FieldRelationships = []field.SchemaFieldRelationship{}
+	FieldRelationships = []field.SchemaFieldRelationship{
+		field.FieldsRequiredTogether(OAuthClientIDField, OAuthClientSecretField, OAuthRefreshTokenField),
+		field.FieldsMutuallyExclusive(TokenField, OAuthRefreshTokenField),
+		field.FieldsAtLeastOneUsed(TokenField, OAuthRefreshTokenField, ReplayField),
+		field.FieldsDependentOn([]field.SchemaField{OffboardingSuccessorField}, []field.SchemaField{OffboardingField}),
+		field.FieldsMutuallyExclusive(RecordField, ReplayField),
+	}
 )
 
 // ValidateConfig is run after the configuration is loaded, and should return an
@@ -33,8 +128,39 @@ var (
 // needs to perform extra validations that cannot be encoded with configuration
 // parameters.
 func ValidateConfig(v *viper.Viper) error {
-	if v.GetString(TokenField.FieldName) == "" {
-		return errors.New("token is required")
+	token := v.GetString(TokenField.FieldName)
+	refreshToken := v.GetString(OAuthRefreshTokenField.FieldName)
+
+	switch {
+	case v.GetString(RecordField.FieldName) != "" && v.GetString(ReplayField.FieldName) != "":
+		return errors.New("record and replay cannot be used together")
+	case token == "" && refreshToken == "" && v.GetString(ReplayField.FieldName) == "":
+		return errors.New("either token or oauth-refresh-token is required")
+	case token != "" && refreshToken != "":
+		return errors.New("token and oauth-refresh-token cannot be used together")
+	case refreshToken != "" && (v.GetString(OAuthClientIDField.FieldName) == "" || v.GetString(OAuthClientSecretField.FieldName) == ""):
+		return errors.New("oauth-client-id and oauth-client-secret are required with oauth-refresh-token")
+	}
+
+	if prefetchWorkers := v.GetInt(PrefetchWorkersField.FieldName); v.GetBool(PrefetchTeamMembershipsField.FieldName) &&
+		(prefetchWorkers < 1 || prefetchWorkers > connector.MaxPrefetchWorkers) {
+		return fmt.Errorf("prefetch-workers must be between 1 and %d", connector.MaxPrefetchWorkers)
 	}
+
+	if v.GetInt(DormantAfterDaysField.FieldName) < 0 {
+		return errors.New("dormant-after-days cannot be negative")
+	}
+
+	if len(v.GetStringSlice(SensitiveProjectsField.FieldName)) > 0 && v.GetInt(SensitiveTaskPageLimitField.FieldName) < 1 {
+		return errors.New("sensitive-task-page-limit must be at least 1")
+	}
+
+	if err := connector.ValidateResourceTypes(
+		v.GetStringSlice(ResourceTypesField.FieldName),
+		v.GetStringSlice(SkipGrantsField.FieldName),
+	); err != nil {
+		return err
+	}
+
 	return nil
 }
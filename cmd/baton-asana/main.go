@@ -18,15 +18,20 @@ import (
 
 var version = "dev"
 
+// connectors are closed once the command returns, so that recorded cassettes
+// are synced to disk.
+var connectors []*connector.Asana
+
 func main() {
 	ctx := context.Background()
 
-	_, cmd, err := config.DefineConfiguration(
+	v, cmd, err := config.DefineConfiguration(
 		ctx,
-		"baton-workato",
+		"baton-asana",
 		getConnector,
 		field.Configuration{
-			Fields: ConfigurationFields,
+			Fields:      ConfigurationFields,
+			Constraints: FieldRelationships,
 		},
 	)
 	if err != nil {
@@ -35,8 +40,14 @@ func main() {
 	}
 
 	cmd.Version = version
+	cmd.AddCommand(newWebhookCommand(ctx, v))
 
 	err = cmd.Execute()
+	for _, c := range connectors {
+		if closeErr := c.Close(); closeErr != nil {
+			fmt.Fprintln(os.Stderr, closeErr.Error())
+		}
+	}
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err.Error())
 		os.Exit(1)
@@ -50,11 +61,12 @@ func getConnector(ctx context.Context, v *viper.Viper) (types.ConnectorServer, e
 		return nil, err
 	}
 
-	cb, err := connector.New(ctx, v.GetString(TokenField.FieldName))
+	cb, err := connector.New(ctx, connectorConfig(v))
 	if err != nil {
 		l.Error("error creating connector", zap.Error(err))
 		return nil, err
 	}
+	connectors = append(connectors, cb)
 
 	c, err := connectorbuilder.NewConnector(ctx, cb)
 	if err != nil {
@@ -64,3 +76,30 @@ func getConnector(ctx context.Context, v *viper.Viper) (types.ConnectorServer, e
 
 	return c, nil
 }
+
+// connectorConfig returns the connector options set in v.
+func connectorConfig(v *viper.Viper) connector.Config {
+	cfg := connector.Config{
+		AccessToken:            v.GetString(TokenField.FieldName),
+		OAuthClientID:          v.GetString(OAuthClientIDField.FieldName),
+		OAuthClientSecret:      v.GetString(OAuthClientSecretField.FieldName),
+		OAuthRefreshToken:      v.GetString(OAuthRefreshTokenField.FieldName),
+		Offboarding:            v.GetBool(OffboardingField.FieldName),
+		OffboardingSuccessor:   v.GetString(OffboardingSuccessorField.FieldName),
+		GuestAccessReport:      v.GetBool(GuestAccessReportField.FieldName),
+		DormantAfterDays:       v.GetInt(DormantAfterDaysField.FieldName),
+		SensitiveProjects:      v.GetStringSlice(SensitiveProjectsField.FieldName),
+		SensitiveTaskPageLimit: v.GetInt(SensitiveTaskPageLimitField.FieldName),
+		OrganizationExport:     v.GetBool(OrganizationExportField.FieldName),
+		Record:                 v.GetString(RecordField.FieldName),
+		Replay:                 v.GetString(ReplayField.FieldName),
+		RedactFields:           v.GetStringSlice(RedactFieldsField.FieldName),
+		ResourceTypes:          v.GetStringSlice(ResourceTypesField.FieldName),
+		SkipGrants:             v.GetStringSlice(SkipGrantsField.FieldName),
+	}
+	if v.GetBool(PrefetchTeamMembershipsField.FieldName) {
+		cfg.TeamMembershipPrefetchWorkers = v.GetInt(PrefetchWorkersField.FieldName)
+	}
+
+	return cfg
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/conductorone/baton-asana/pkg/connector"
+	"github.com/conductorone/baton-asana/pkg/webhook"
+	"github.com/conductorone/baton-sdk/pkg/field"
+	"github.com/conductorone/baton-sdk/pkg/logging"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+var (
+	WebhookListenAddressField = field.StringField(
+		"listen-address",
+		field.WithDescription("The address the webhook receiver listens on"),
+		field.WithDefaultValue(":8080"),
+	)
+	WebhookTargetUrlField = field.StringField(
+		"target-url",
+		field.WithDescription("The public URL Asana delivers webhook events to, forwarded to the listen address"),
+	)
+
+	// webhookFields are the fields of the webhook command, along with the
+	// fields used to connect to the Asana API.
+	webhookFields = []field.SchemaField{
+		TokenField,
+		OAuthClientIDField,
+		OAuthClientSecretField,
+		OAuthRefreshTokenField,
+		WebhookListenAddressField,
+		WebhookTargetUrlField,
+	}
+)
+
+// webhookOutput is a single line written by the webhook command for each
+// change received.
+type webhookOutput struct {
+	Type         string          `json:"type"`
+	Event        json.RawMessage `json:"event,omitempty"`
+	ResourceType string          `json:"resource_type,omitempty"`
+	ResourceId   string          `json:"resource_id,omitempty"`
+}
+
+// newWebhookCommand returns the command registering Asana webhooks for
+// workspace and team membership changes and writing the resulting events and
+// resync requests to stdout as JSON lines.
+func newWebhookCommand(ctx context.Context, v *viper.Viper) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "webhook",
+		Short: "Receive Asana webhooks and write membership events and resync requests to stdout",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if err := v.BindPFlags(cmd.Flags()); err != nil {
+				return err
+			}
+			return runWebhook(ctx, v)
+		},
+	}
+
+	for _, f := range webhookFields {
+		value, _ := f.String()
+		cmd.Flags().String(f.FieldName, value, f.GetDescription())
+	}
+
+	return cmd
+}
+
+func runWebhook(ctx context.Context, v *viper.Viper) error {
+	if err := ValidateConfig(v); err != nil {
+		return err
+	}
+	if v.GetString(WebhookTargetUrlField.FieldName) == "" {
+		return fmt.Errorf("%s is required", WebhookTargetUrlField.FieldName)
+	}
+
+	ctx, err := logging.Init(ctx,
+		logging.WithLogFormat(v.GetString("log-format")),
+		logging.WithLogLevel(v.GetString("log-level")),
+	)
+	if err != nil {
+		return err
+	}
+	l := ctxzap.Extract(ctx)
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	client, closer, err := connector.NewClient(ctx, connectorConfig(v))
+	if err != nil {
+		return err
+	}
+	if closer != nil {
+		defer closer.Close()
+	}
+
+	var outMu sync.Mutex
+	encoder := json.NewEncoder(os.Stdout)
+	handler := webhook.NewHandler(l, func(change connector.WebhookChange) {
+		var lines []webhookOutput
+		if change.Event != nil {
+			event, err := protojson.Marshal(change.Event)
+			if err != nil {
+				l.Error("baton-asana: failed to marshal event", zap.Error(err))
+			} else {
+				lines = append(lines, webhookOutput{Type: "event", Event: event})
+			}
+		}
+		if change.Resync != nil {
+			lines = append(lines, webhookOutput{
+				Type:         "resync",
+				ResourceType: change.Resync.ResourceType,
+				ResourceId:   change.Resync.Resource,
+			})
+		}
+
+		outMu.Lock()
+		defer outMu.Unlock()
+		for _, line := range lines {
+			if err := encoder.Encode(line); err != nil {
+				l.Error("baton-asana: failed to write change", zap.Error(err))
+			}
+		}
+	})
+
+	server := &http.Server{
+		Addr:              v.GetString(WebhookListenAddressField.FieldName),
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.ListenAndServe()
+	}()
+
+	registrar := webhook.NewRegistrar(client, handler, l, v.GetString(WebhookTargetUrlField.FieldName))
+	registered, err := registrar.Register(ctx)
+	if err != nil {
+		_ = server.Close()
+		return err
+	}
+	l.Info("baton-asana: receiving webhooks", zap.Int("webhooks", registered), zap.String("address", server.Addr))
+
+	select {
+	case err := <-serveErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return nil
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return server.Shutdown(shutdownCtx)
+}
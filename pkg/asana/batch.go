@@ -0,0 +1,173 @@
+package asana
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/conductorone/baton-sdk/pkg/uhttp"
+	"google.golang.org/grpc/codes"
+)
+
+// MaxBatchActions is the number of actions Asana accepts in a single batch request.
+const MaxBatchActions = 10
+
+type BatchActionOptions struct {
+	Limit  int      `json:"limit,omitempty"`
+	Offset string   `json:"offset,omitempty"`
+	Fields []string `json:"fields,omitempty"`
+}
+
+// BatchAction is a single API call executed as part of a batch request.
+type BatchAction struct {
+	RelativePath string              `json:"relative_path"`
+	Method       string              `json:"method"`
+	Data         any                 `json:"data,omitempty"`
+	Options      *BatchActionOptions `json:"options,omitempty"`
+}
+
+// BatchResult is the response of a single batch action.
+type BatchResult struct {
+	StatusCode int               `json:"status_code"`
+	Headers    map[string]string `json:"headers"`
+	Body       json.RawMessage   `json:"body"`
+}
+
+type batchRequestData struct {
+	Actions []BatchAction `json:"actions"`
+}
+
+type batchResponse struct {
+	Data []BatchResult `json:"data"`
+}
+
+// TeamMembershipsPage is a single page of memberships of a team.
+type TeamMembershipsPage struct {
+	Memberships []TeamMembership
+	NextOffset  string
+}
+
+// Decode unmarshals the body of a successful action into v, or returns the
+// error reported by Asana for a failed one.
+func (r BatchResult) Decode(v any) error {
+	if r.StatusCode >= http.StatusOK && r.StatusCode < http.StatusMultipleChoices {
+		return json.Unmarshal(r.Body, v)
+	}
+
+	var errRes ErrorResponse
+	if err := json.Unmarshal(r.Body, &errRes); err != nil {
+		return fmt.Errorf("batch action failed with status %d", r.StatusCode)
+	}
+
+	return uhttp.WrapErrors(batchStatusCode(r.StatusCode), fmt.Sprintf("batch action failed with status %d: %s", r.StatusCode, errRes.Message()))
+}
+
+// maps the status code of a batch action the same way uhttp maps top level responses.
+func batchStatusCode(statusCode int) codes.Code {
+	switch statusCode {
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusConflict:
+		return codes.AlreadyExists
+	case http.StatusTooManyRequests:
+		return codes.Unavailable
+	}
+
+	if statusCode >= http.StatusInternalServerError {
+		return codes.Unavailable
+	}
+
+	return codes.Unknown
+}
+
+// Batch executes actions through the Asana Batch API, splitting them into as
+// many requests of at most MaxBatchActions as needed. Results are returned in
+// the same order as actions; a failed action does not fail the whole batch.
+func (c *Client) Batch(ctx context.Context, actions []BatchAction) ([]BatchResult, error) {
+	rv := make([]BatchResult, 0, len(actions))
+	for start := 0; start < len(actions); start += MaxBatchActions {
+		end := min(start+MaxBatchActions, len(actions))
+
+		var res batchResponse
+		_, err := c.doRequest(ctx, http.MethodPost, "/batch", nil, batchRequestData{Actions: actions[start:end]}, &res)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(res.Data) != end-start {
+			return nil, fmt.Errorf("baton-asana: batch returned %d results for %d actions", len(res.Data), end-start)
+		}
+		rv = append(rv, res.Data...)
+	}
+
+	return rv, nil
+}
+
+// GetWorkspaces returns details of the given workspaces using batch requests.
+func (c *Client) GetWorkspaces(ctx context.Context, workspaceIds []string) ([]Workspace, error) {
+	actions := make([]BatchAction, 0, len(workspaceIds))
+	for _, workspaceId := range workspaceIds {
+		actions = append(actions, BatchAction{
+			RelativePath: fmt.Sprintf("/workspaces/%s", workspaceId),
+			Method:       "get",
+			Options:      &BatchActionOptions{Fields: workspaceFields},
+		})
+	}
+
+	results, err := c.Batch(ctx, actions)
+	if err != nil {
+		return nil, err
+	}
+
+	rv := make([]Workspace, 0, len(results))
+	for i, result := range results {
+		var res WorkspaceResponse
+		if err := result.Decode(&res); err != nil {
+			return nil, fmt.Errorf("baton-asana: failed to get workspace %s: %w", workspaceIds[i], err)
+		}
+		rv = append(rv, res.Data)
+	}
+
+	return rv, nil
+}
+
+// GetTeamMembershipsFirstPages returns the first page of memberships of each
+// of the given teams using batch requests. Teams whose action failed are left
+// out of the result so callers can fall back to GetTeamMemberships.
+func (c *Client) GetTeamMembershipsFirstPages(ctx context.Context, teamIds []string, limit int) (map[string]TeamMembershipsPage, error) {
+	actions := make([]BatchAction, 0, len(teamIds))
+	for _, teamId := range teamIds {
+		actions = append(actions, BatchAction{
+			RelativePath: fmt.Sprintf("/teams/%s/team_memberships", teamId),
+			Method:       "get",
+			Options: &BatchActionOptions{
+				Limit:  limit,
+				Fields: teamMembershipFields,
+			},
+		})
+	}
+
+	results, err := c.Batch(ctx, actions)
+	if err != nil {
+		return nil, err
+	}
+
+	rv := make(map[string]TeamMembershipsPage, len(results))
+	for i, result := range results {
+		var res ListResponse[TeamMembership]
+		if err := result.Decode(&res); err != nil {
+			continue
+		}
+		rv[teamIds[i]] = TeamMembershipsPage{
+			Memberships: res.Data,
+			NextOffset:  res.NextPage.Offset,
+		}
+	}
+
+	return rv, nil
+}
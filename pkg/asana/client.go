@@ -4,41 +4,36 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"iter"
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/conductorone/baton-sdk/pkg/uhttp"
+	"google.golang.org/grpc/codes"
 )
 
-const BaseUrl = "https://app.asana.com/api/1.0"
+const (
+	BaseUrl       = "https://app.asana.com/api/1.0"
+	OAuthTokenUrl = "https://app.asana.com/-/oauth_token"
+)
 
 type Client struct {
 	httpClient  *uhttp.BaseHttpClient
 	accessToken string
-}
-
-type UsersResponse struct {
-	Data     []User         `json:"data"`
-	NextPage PaginationData `json:"next_page"`
+	// downloadClient fetches pre-signed download URLs, which must not be
+	// sent the credentials of the client.
+	downloadClient *http.Client
 }
 
 type WorkspaceResponse struct {
 	Data Workspace `json:"data"`
 }
 
-type AuthCheckResponse struct {
-	Data []WorkspaceMembership `json:"data"`
-}
-
-type WorkspaceMembershipsResponse struct {
-	Data     []WorkspaceMembership `json:"data"`
-	NextPage PaginationData        `json:"next_page"`
-}
-
-type TeamMembershipsResponse struct {
-	Data     []TeamMembership `json:"data"`
-	NextPage PaginationData   `json:"next_page"`
+type UserResponse struct {
+	Data User `json:"data"`
 }
 
 type GetUsersVars struct {
@@ -59,357 +54,657 @@ type GetTeamMembershipsVars struct {
 	TeamId string
 }
 
+type GetTeamJoinRequestsVars struct {
+	Limit  int    `json:"limit"`
+	Offset string `json:"offset"`
+	TeamId string
+}
+
 type GetTeamsVars struct {
 	Limit       int    `json:"limit"`
 	Offset      string `json:"offset"`
 	WorkspaceId string
 }
 
-type TeamsResponse struct {
-	Data     []Team         `json:"data"`
-	NextPage PaginationData `json:"next_page"`
+var (
+	workspaceFields           = []string{"is_organization", "name", "email_domains"}
+	teamMembershipFields      = []string{"team.name", "is_limited_access", "is_admin", "is_guest", "user.name", "user.email"}
+	workspaceMembershipFields = []string{"name", "is_active", "is_admin", "is_guest", "is_view_only", "created_at", "vacation_dates", "title", "department", "workspace.name", "user.name", "user.email", "user.photo.image_128x128"}
+	projectFields             = []string{"name", "archived", "privacy_setting", "owner.name", "owner.email", "team.name", "workspace.name"}
+	taskFields                = []string{"name", "completed", "followers.name", "followers.email"}
+	teamJoinRequestFields     = []string{"created_at", "user.name", "user.email", "team.name"}
+)
+
+type GetCustomFieldsVars struct {
+	Limit       int    `json:"limit"`
+	Offset      string `json:"offset"`
+	WorkspaceId string
+}
+
+type GetMembershipsVars struct {
+	Limit    int    `json:"limit"`
+	Offset   string `json:"offset"`
+	ParentId string
+}
+
+type GetProjectsVars struct {
+	Limit       int    `json:"limit"`
+	Offset      string `json:"offset"`
+	WorkspaceId string
+}
+
+type GetProjectTemplatesVars struct {
+	Limit       int    `json:"limit"`
+	Offset      string `json:"offset"`
+	WorkspaceId string
+}
+
+type GetPortfoliosVars struct {
+	Limit       int    `json:"limit"`
+	Offset      string `json:"offset"`
+	WorkspaceId string
+	// OwnerId restricts the portfolios to those of a single owner. Unless
+	// authenticated as a service account, Asana requires it to be "me".
+	OwnerId string
+}
+
+type GetPortfolioItemsVars struct {
+	Limit       int    `json:"limit"`
+	Offset      string `json:"offset"`
+	PortfolioId string
+}
+
+type GetProjectTasksVars struct {
+	Limit     int    `json:"limit"`
+	Offset    string `json:"offset"`
+	ProjectId string
 }
 
 func NewClient(accessToken string, httpClient *uhttp.BaseHttpClient) *Client {
 	return &Client{
-		accessToken: accessToken,
-		httpClient:  httpClient,
+		accessToken:    accessToken,
+		httpClient:     httpClient,
+		downloadClient: http.DefaultClient,
 	}
 }
 
+// SetDownloadClient replaces the HTTP client pre-signed download URLs are
+// fetched with.
+func (c *Client) SetDownloadClient(downloadClient *http.Client) {
+	c.downloadClient = downloadClient
+}
+
 // returns query params with pagination options.
 func paginationQuery(q url.Values, limit int, offset string) url.Values {
-	q.Add("limit", strconv.Itoa(limit))
+	if limit > 0 {
+		q.Set("limit", strconv.Itoa(limit))
+	}
 	if offset != "" {
-		q.Add("offset", offset)
+		q.Set("offset", offset)
 	}
 	return q
 }
 
-// GetUsers returns all users for a single workspace.
-func (c *Client) GetUsers(ctx context.Context, getUsersVars GetUsersVars) ([]User, string, *http.Response, error) {
-	usersUrl := fmt.Sprint(BaseUrl, "/users")
-	q := url.Values{}
-	q.Add("workspace", getUsersVars.WorkspaceId)
-	q.Add("opt_fields", "email,name")
-	q = paginationQuery(q, getUsersVars.Limit, getUsersVars.Offset)
-
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, usersUrl, nil)
+// newRequest builds an authenticated request to the Asana API. A nil body
+// sends no payload.
+func (c *Client) newRequest(ctx context.Context, method, path string, q url.Values, body any) (*http.Request, error) {
+	requestUrl, err := getPath(BaseUrl, path)
 	if err != nil {
-		return nil, "", nil, err
+		return nil, err
 	}
-
-	req.URL.RawQuery = q.Encode()
-	req.Header.Add("authorization", fmt.Sprint("Bearer ", c.accessToken))
-	req.Header.Add("accept", "application/json")
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return nil, "", nil, err
+	if len(q) > 0 {
+		requestUrl.RawQuery = q.Encode()
 	}
-	defer resp.Body.Close()
 
-	var res UsersResponse
-	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
-		return nil, "", nil, err
+	reqOpts := []uhttp.RequestOption{uhttp.WithAcceptJSONHeader()}
+	// Without an access token requests are authenticated by the OAuth
+	// transport of the underlying HTTP client.
+	if c.accessToken != "" {
+		reqOpts = append(reqOpts, uhttp.WithBearerToken(c.accessToken))
 	}
-
-	if (res.NextPage != PaginationData{}) {
-		return res.Data, res.NextPage.Offset, resp, nil
+	if body != nil {
+		reqOpts = append(reqOpts, uhttp.WithJSONBody(baseMutationBody{Data: body}))
 	}
 
-	return res.Data, "", resp, nil
+	return c.httpClient.NewRequest(ctx, method, requestUrl, reqOpts...)
 }
 
-// GetWorkspace returns details of a single workspace.
-func (c *Client) GetWorkspace(ctx context.Context, workspaceId string) (Workspace, *http.Response, error) {
-	workspaceUrl := fmt.Sprintf("%s/workspaces/%s", BaseUrl, workspaceId)
-	q := url.Values{}
-	q.Add("opt_fields", "is_organization,name,email_domains")
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, workspaceUrl, nil)
+// doRequest sends an authenticated request to the Asana API and decodes the
+// JSON response into res. A nil body sends no payload and a nil res discards
+// the response body.
+func (c *Client) doRequest(ctx context.Context, method, path string, q url.Values, body any, res any) (*http.Response, error) {
+	req, err := c.newRequest(ctx, method, path, q, body)
 	if err != nil {
-		return Workspace{}, nil, err
+		return nil, err
 	}
 
-	req.URL.RawQuery = q.Encode()
-	req.Header.Add("authorization", fmt.Sprint("Bearer ", c.accessToken))
-	req.Header.Add("accept", "application/json")
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return Workspace{}, nil, err
+	var errRes ErrorResponse
+	doOpts := []uhttp.DoOption{uhttp.WithErrorResponse(&errRes)}
+	if res != nil {
+		doOpts = append(doOpts, uhttp.WithJSONResponse(res))
 	}
-	defer resp.Body.Close()
 
-	var res WorkspaceResponse
-	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
-		return Workspace{}, nil, err
+	resp, err := c.httpClient.Do(req, doOpts...)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if err != nil {
+		if membershipErr := errRes.membershipError(); membershipErr != nil {
+			return resp, fmt.Errorf("%w: %w", membershipErr, err)
+		}
+		return resp, err
 	}
 
-	return res.Data, resp, nil
+	return resp, nil
 }
 
-// GetWorkspaceMemberships returns all workspace memberships for a single workspace.
-func (c *Client) GetWorkspaceMemberships(ctx context.Context, getWorkspaceMembershipsVars GetWorkspaceMembershipsVars) ([]WorkspaceMembership, string, *http.Response, error) {
-	membershipsUrl := fmt.Sprintf("%s/workspaces/%s/workspace_memberships", BaseUrl, getWorkspaceMembershipsVars.WorkspaceId)
-	q := url.Values{}
-	q.Add("opt_fields", "name,is_active,is_admin,is_guest,workspace.name,user.name,user.email")
-	q = paginationQuery(q, getWorkspaceMembershipsVars.Limit, getWorkspaceMembershipsVars.Offset)
-
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, membershipsUrl, nil)
+// doUncachedRequest sends a GET request to the Asana API like doRequest, but
+// through the underlying HTTP client, so that the response is neither served
+// from nor stored in the response cache. It is used to read back changes just
+// made without clearing the cache of the whole sync.
+func (c *Client) doUncachedRequest(ctx context.Context, path string, q url.Values, res any) (*http.Response, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, path, q, nil)
 	if err != nil {
-		return nil, "", nil, err
+		return nil, err
 	}
 
-	req.URL.RawQuery = q.Encode()
-	req.Header.Add("authorization", fmt.Sprint("Bearer ", c.accessToken))
-	req.Header.Add("accept", "application/json")
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.httpClient.HttpClient.Do(req)
 	if err != nil {
-		return nil, "", nil, err
+		return nil, err
 	}
 	defer resp.Body.Close()
 
-	var res WorkspaceMembershipsResponse
-	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
-		return nil, "", nil, err
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var errRes ErrorResponse
+		_ = json.NewDecoder(resp.Body).Decode(&errRes)
+
+		code := codes.Unknown
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+			code = codes.Unavailable
+		}
+		return resp, uhttp.WrapErrorsWithRateLimitInfo(code, resp, fmt.Errorf("baton-asana: %s", errRes.Message()))
 	}
 
-	if (res.NextPage != PaginationData{}) {
-		return res.Data, res.NextPage.Offset, resp, nil
+	if err := json.NewDecoder(resp.Body).Decode(res); err != nil {
+		return resp, fmt.Errorf("baton-asana: failed to decode response: %w", err)
 	}
 
-	return res.Data, "", resp, nil
+	return resp, nil
 }
 
-// GetTeams returns all teams for a single workspace.
-func (c *Client) GetTeams(ctx context.Context, getTeamsVars GetTeamsVars) ([]Team, string, *http.Response, error) {
-	teamsUrl := fmt.Sprintf("%s/workspaces/%s/teams", BaseUrl, getTeamsVars.WorkspaceId)
-	q := url.Values{}
-	q.Add("opt_fields", "name,organization.name,organization.id,user.name,user.email")
-	q = paginationQuery(q, getTeamsVars.Limit, getTeamsVars.Offset)
+// GetUsers returns all users for a single workspace.
+func (c *Client) GetUsers(ctx context.Context, getUsersVars GetUsersVars) ([]User, string, *http.Response, error) {
+	return List[User](ctx, c, "/users", ListOptions{
+		Query:     url.Values{"workspace": {getUsersVars.WorkspaceId}},
+		OptFields: []string{"email", "name", "photo.image_128x128"},
+		Limit:     getUsersVars.Limit,
+		Offset:    getUsersVars.Offset,
+	})
+}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, teamsUrl, nil)
-	if err != nil {
-		return nil, "", nil, err
-	}
+// GetWorkspace returns details of a single workspace.
+func (c *Client) GetWorkspace(ctx context.Context, workspaceId string) (Workspace, *http.Response, error) {
+	q := url.Values{}
+	q.Add("opt_fields", strings.Join(workspaceFields, ","))
 
-	req.URL.RawQuery = q.Encode()
-	req.Header.Add("authorization", fmt.Sprint("Bearer ", c.accessToken))
-	req.Header.Add("accept", "application/json")
-	resp, err := c.httpClient.Do(req)
+	var res WorkspaceResponse
+	resp, err := c.doRequest(ctx, http.MethodGet, fmt.Sprintf("/workspaces/%s", workspaceId), q, nil, &res)
 	if err != nil {
-		return nil, "", nil, err
+		return Workspace{}, resp, err
 	}
-	defer resp.Body.Close()
 
-	var res TeamsResponse
-	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
-		return nil, "", nil, err
-	}
+	return res.Data, resp, nil
+}
 
-	if (res.NextPage != PaginationData{}) {
-		return res.Data, res.NextPage.Offset, resp, nil
-	}
+// GetWorkspaceMemberships returns all workspace memberships for a single workspace.
+func (c *Client) GetWorkspaceMemberships(ctx context.Context, getWorkspaceMembershipsVars GetWorkspaceMembershipsVars) ([]WorkspaceMembership, string, *http.Response, error) {
+	return List[WorkspaceMembership](ctx, c, fmt.Sprintf("/workspaces/%s/workspace_memberships", getWorkspaceMembershipsVars.WorkspaceId), ListOptions{
+		OptFields: workspaceMembershipFields,
+		Limit:     getWorkspaceMembershipsVars.Limit,
+		Offset:    getWorkspaceMembershipsVars.Offset,
+	})
+}
 
-	return res.Data, "", resp, nil
+// GetTeams returns all teams for a single workspace.
+func (c *Client) GetTeams(ctx context.Context, getTeamsVars GetTeamsVars) ([]Team, string, *http.Response, error) {
+	return List[Team](ctx, c, fmt.Sprintf("/workspaces/%s/teams", getTeamsVars.WorkspaceId), ListOptions{
+		OptFields: []string{"name", "visibility", "organization.name", "organization.id", "user.name", "user.email"},
+		Limit:     getTeamsVars.Limit,
+		Offset:    getTeamsVars.Offset,
+	})
 }
 
 // GetTeamMemberships returns all team memberships for a single team.
 func (c *Client) GetTeamMemberships(ctx context.Context, getTeamMembershipsVars GetTeamMembershipsVars) ([]TeamMembership, string, *http.Response, error) {
-	teamMembershipsUrl := fmt.Sprintf("%s/teams/%s/team_memberships", BaseUrl, getTeamMembershipsVars.TeamId)
-	q := url.Values{}
-	q.Add("opt_fields", "team.name,is_limited_access,is_admin,is_guest,user.name,user.email")
-	q = paginationQuery(q, getTeamMembershipsVars.Limit, getTeamMembershipsVars.Offset)
+	return List[TeamMembership](ctx, c, fmt.Sprintf("/teams/%s/team_memberships", getTeamMembershipsVars.TeamId), ListOptions{
+		OptFields: teamMembershipFields,
+		Limit:     getTeamMembershipsVars.Limit,
+		Offset:    getTeamMembershipsVars.Offset,
+	})
+}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, teamMembershipsUrl, nil)
-	if err != nil {
-		return nil, "", nil, err
-	}
+// GetTeamJoinRequests returns the pending requests of users to join a team.
+// Join requests are not available to every organization, in which case the
+// request fails with a client error.
+func (c *Client) GetTeamJoinRequests(ctx context.Context, getTeamJoinRequestsVars GetTeamJoinRequestsVars) ([]TeamJoinRequest, string, *http.Response, error) {
+	return List[TeamJoinRequest](ctx, c, fmt.Sprintf("/teams/%s/join_requests", getTeamJoinRequestsVars.TeamId), ListOptions{
+		OptFields: teamJoinRequestFields,
+		Limit:     getTeamJoinRequestsVars.Limit,
+		Offset:    getTeamJoinRequestsVars.Offset,
+	})
+}
 
-	req.URL.RawQuery = q.Encode()
-	req.Header.Add("authorization", fmt.Sprint("Bearer ", c.accessToken))
-	req.Header.Add("accept", "application/json")
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return nil, "", nil, err
-	}
-	defer resp.Body.Close()
+// ApproveTeamJoinRequest approves a pending request to join a team, making
+// the requesting user a member.
+func (c *Client) ApproveTeamJoinRequest(ctx context.Context, joinRequestId string) error {
+	_, err := c.doRequest(ctx, http.MethodPost, fmt.Sprintf("/team_join_requests/%s/approve", joinRequestId), nil, struct{}{}, nil)
+	return err
+}
 
-	var res TeamMembershipsResponse
-	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
-		return nil, "", nil, err
-	}
+// GetCustomFields returns all custom fields for a single workspace.
+func (c *Client) GetCustomFields(ctx context.Context, getCustomFieldsVars GetCustomFieldsVars) ([]CustomField, string, *http.Response, error) {
+	return List[CustomField](ctx, c, fmt.Sprintf("/workspaces/%s/custom_fields", getCustomFieldsVars.WorkspaceId), ListOptions{
+		OptFields: []string{"name", "resource_subtype", "description", "is_global_to_workspace", "privacy_setting", "created_by.name", "created_by.email"},
+		Limit:     getCustomFieldsVars.Limit,
+		Offset:    getCustomFieldsVars.Offset,
+	})
+}
 
-	if (res.NextPage != PaginationData{}) {
-		return res.Data, res.NextPage.Offset, resp, nil
+// GetProjects returns all projects for a single workspace.
+func (c *Client) GetProjects(ctx context.Context, getProjectsVars GetProjectsVars) ([]Project, string, *http.Response, error) {
+	return List[Project](ctx, c, "/projects", ListOptions{
+		Query:     url.Values{"workspace": {getProjectsVars.WorkspaceId}},
+		OptFields: projectFields,
+		Limit:     getProjectsVars.Limit,
+		Offset:    getProjectsVars.Offset,
+	})
+}
+
+// GetProjectTemplates returns all project templates for a single workspace.
+// Project templates are only available on paid plans.
+func (c *Client) GetProjectTemplates(ctx context.Context, getProjectTemplatesVars GetProjectTemplatesVars) ([]ProjectTemplate, string, *http.Response, error) {
+	return List[ProjectTemplate](ctx, c, "/project_templates", ListOptions{
+		Query:     url.Values{"workspace": {getProjectTemplatesVars.WorkspaceId}},
+		OptFields: []string{"name", "description", "public", "owner.name", "owner.email", "team.name", "requested_roles.name"},
+		Limit:     getProjectTemplatesVars.Limit,
+		Offset:    getProjectTemplatesVars.Offset,
+	})
+}
+
+// GetPortfolios returns all portfolios for a single workspace.
+func (c *Client) GetPortfolios(ctx context.Context, getPortfoliosVars GetPortfoliosVars) ([]Portfolio, string, *http.Response, error) {
+	q := url.Values{"workspace": {getPortfoliosVars.WorkspaceId}}
+	if getPortfoliosVars.OwnerId != "" {
+		q.Set("owner", getPortfoliosVars.OwnerId)
 	}
 
-	return res.Data, "", resp, nil
+	return List[Portfolio](ctx, c, "/portfolios", ListOptions{
+		Query:     q,
+		OptFields: []string{"name", "public", "owner.name", "owner.email", "workspace.name"},
+		Limit:     getPortfoliosVars.Limit,
+		Offset:    getPortfoliosVars.Offset,
+	})
+}
+
+// GetPortfolioItems returns the projects and portfolios contained in a single portfolio.
+func (c *Client) GetPortfolioItems(ctx context.Context, getPortfolioItemsVars GetPortfolioItemsVars) ([]BaseResource, string, *http.Response, error) {
+	return List[BaseResource](ctx, c, fmt.Sprintf("/portfolios/%s/items", getPortfolioItemsVars.PortfolioId), ListOptions{
+		OptFields: []string{"name"},
+		Limit:     getPortfolioItemsVars.Limit,
+		Offset:    getPortfolioItemsVars.Offset,
+	})
+}
+
+// GetMemberships returns all memberships of a single goal, project, portfolio or custom field.
+func (c *Client) GetMemberships(ctx context.Context, getMembershipsVars GetMembershipsVars) ([]Membership, string, *http.Response, error) {
+	return List[Membership](ctx, c, "/memberships", ListOptions{
+		Query:     url.Values{"parent": {getMembershipsVars.ParentId}},
+		OptFields: []string{"parent.name", "member.name", "access_level"},
+		Limit:     getMembershipsVars.Limit,
+		Offset:    getMembershipsVars.Offset,
+	})
+}
+
+// AllTeamMemberships returns an iterator over every membership of a single team.
+func (c *Client) AllTeamMemberships(ctx context.Context, teamId string) iter.Seq2[TeamMembership, error] {
+	return All[TeamMembership](ctx, c, fmt.Sprintf("/teams/%s/team_memberships", teamId), ListOptions{
+		OptFields: teamMembershipFields,
+	})
 }
 
 // AuthCheck returns workspace permissions of an authenticated user.
 func (c *Client) AuthCheck(ctx context.Context) ([]WorkspaceMembership, error) {
-	authUrl := fmt.Sprint(BaseUrl, "/users/me/workspace_memberships")
+	var rv []WorkspaceMembership
+	for workspaceMembership, err := range All[WorkspaceMembership](ctx, c, "/users/me/workspace_memberships", ListOptions{
+		OptFields: []string{"workspace.name", "workspace.gid", "workspace.is_organization", "is_active", "is_admin", "is_guest"},
+	}) {
+		if err != nil {
+			return nil, err
+		}
+		rv = append(rv, workspaceMembership)
+	}
+
+	return rv, nil
+}
+
+// AddUserToWorkspace adds a user to a workspace. It returns an error matching
+// ErrAlreadyMember when the user is already a member.
+func (c *Client) AddUserToWorkspace(ctx context.Context, workspaceId, userId string) error {
+	_, err := c.doRequest(ctx, http.MethodPost, fmt.Sprintf("/workspaces/%s/addUser", workspaceId), nil, userMutationData{User: userId}, nil)
+	return err
+}
+
+// RemoveUserToWorkspace removes a user from a workspace. It returns an error
+// matching ErrNotMember when the user is not a member.
+func (c *Client) RemoveUserToWorkspace(ctx context.Context, workspaceId, userId string) error {
+	_, err := c.doRequest(ctx, http.MethodPost, fmt.Sprintf("/workspaces/%s/removeUser", workspaceId), nil, userMutationData{User: userId}, nil)
+	return err
+}
+
+// AddUserToTeam adds a user to a team. It returns an error matching
+// ErrAlreadyMember when the user is already a member.
+func (c *Client) AddUserToTeam(ctx context.Context, teamId, userId string) error {
+	_, err := c.doRequest(ctx, http.MethodPost, fmt.Sprintf("/teams/%s/addUser", teamId), nil, userMutationData{User: userId}, nil)
+	return err
+}
+
+// RemoveUserToTeam removes a user to a team. It returns an error matching
+// ErrNotMember when the user is not a member.
+func (c *Client) RemoveUserToTeam(ctx context.Context, teamId, userId string) error {
+	_, err := c.doRequest(ctx, http.MethodPost, fmt.Sprintf("/teams/%s/removeUser", teamId), nil, userMutationData{User: userId}, nil)
+	return err
+}
+
+// GetTeam returns a single team.
+func (c *Client) GetTeam(ctx context.Context, teamId string) (Team, error) {
 	q := url.Values{}
-	q.Add("opt_fields", "workspace.name,workspace.gid,is_active,is_admin,is_guest")
+	q.Add("opt_fields", "name,visibility")
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, authUrl, nil)
+	var res TeamResponse
+	_, err := c.doRequest(ctx, http.MethodGet, fmt.Sprintf("/teams/%s", teamId), q, nil, &res)
 	if err != nil {
-		return nil, err
+		return Team{}, err
 	}
 
-	req.URL.RawQuery = q.Encode()
-	req.Header.Add("authorization", fmt.Sprint("Bearer ", c.accessToken))
-	req.Header.Add("accept", "application/json")
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
+	return res.Data, nil
+}
+
+// GetTeamMembership returns the membership of a user in a team, or nil when
+// the user is not a member. It bypasses the response cache, so that the
+// membership reflects changes just made.
+func (c *Client) GetTeamMembership(ctx context.Context, teamId, userId string) (*TeamMembership, error) {
+	memberships, _, _, err := List[TeamMembership](ctx, c, "/team_memberships", ListOptions{
+		Query:     url.Values{"team": {teamId}, "user": {userId}},
+		OptFields: teamMembershipFields,
+		Limit:     1,
+		Uncached:  true,
+	})
+	if err != nil || len(memberships) == 0 {
 		return nil, err
 	}
-	defer resp.Body.Close()
 
-	var res AuthCheckResponse
-	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+	return &memberships[0], nil
+}
+
+// GetWorkspaceMembership returns the membership of a user in a workspace, or
+// nil when the user was never a member. It bypasses the response cache, so
+// that the membership reflects changes just made.
+func (c *Client) GetWorkspaceMembership(ctx context.Context, workspaceId, userId string) (*WorkspaceMembership, error) {
+	memberships, _, _, err := List[WorkspaceMembership](ctx, c, fmt.Sprintf("/workspaces/%s/workspace_memberships", workspaceId), ListOptions{
+		Query:     url.Values{"user": {userId}},
+		OptFields: workspaceMembershipFields,
+		Limit:     1,
+		Uncached:  true,
+	})
+	if err != nil || len(memberships) == 0 {
 		return nil, err
 	}
 
-	return res.Data, nil
+	return &memberships[0], nil
 }
 
-// AddUserToWorkspace adds a user to a workspace.
-func (c *Client) AddUserToWorkspace(ctx context.Context, workspaceId, userId string) error {
-	addUserToWorkspaceUrl, err := getPath(BaseUrl, fmt.Sprintf("/workspaces/%s/addUser", workspaceId))
+// GetCurrentUser returns the user or service account the client is authenticated as.
+func (c *Client) GetCurrentUser(ctx context.Context) (User, error) {
+	q := url.Values{}
+	q.Add("opt_fields", "email,name")
+
+	var res UserResponse
+	_, err := c.doRequest(ctx, http.MethodGet, "/users/me", q, nil, &res)
 	if err != nil {
-		return err
+		return User{}, err
 	}
 
-	body := baseMutationBody{
-		Data: struct {
-			User string `json:"user"`
-		}{
-			User: userId,
-		},
-	}
+	return res.Data, nil
+}
 
-	req, err := c.httpClient.NewRequest(
-		ctx,
-		http.MethodPost,
-		addUserToWorkspaceUrl,
-		uhttp.WithBearerToken(c.accessToken),
-		uhttp.WithJSONBody(body),
-	)
-	if err != nil {
-		return err
+// Probe reports whether the authenticated user can read the endpoint at path.
+// Client errors other than rate limiting report no access, any other error
+// is returned as is.
+func (c *Client) Probe(ctx context.Context, path string, q url.Values) (bool, error) {
+	resp, err := c.doRequest(ctx, http.MethodGet, path, q, nil, nil)
+	if err == nil {
+		return true, nil
 	}
 
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return err
+	if resp != nil && resp.StatusCode >= http.StatusBadRequest && resp.StatusCode < http.StatusInternalServerError &&
+		resp.StatusCode != http.StatusTooManyRequests {
+		return false, nil
 	}
-	defer resp.Body.Close()
 
-	return nil
+	return false, err
 }
 
-// RemoveUserToWorkspace removes a user from a workspace.
-func (c *Client) RemoveUserToWorkspace(ctx context.Context, workspaceId, userId string) error {
-	removeUserToWorkspaceUrl, err := getPath(BaseUrl, fmt.Sprintf("/workspaces/%s/removeUser", workspaceId))
-	if err != nil {
-		return err
-	}
+// CanReadWorkspaceMemberships reports whether memberships of a workspace can be listed.
+func (c *Client) CanReadWorkspaceMemberships(ctx context.Context, workspaceId string) (bool, error) {
+	return c.Probe(ctx, fmt.Sprintf("/workspaces/%s/workspace_memberships", workspaceId), url.Values{"limit": {"1"}})
+}
 
-	body := baseMutationBody{
-		Data: struct {
-			User string `json:"user"`
-		}{
-			User: userId,
-		},
-	}
+// CanReadAuditLog reports whether the audit log of a workspace can be read.
+// Asana only grants audit log access to Enterprise service accounts.
+func (c *Client) CanReadAuditLog(ctx context.Context, workspaceId string) (bool, error) {
+	return c.Probe(ctx, fmt.Sprintf("/workspaces/%s/audit_log_events", workspaceId), url.Values{"limit": {"1"}})
+}
 
-	req, err := c.httpClient.NewRequest(
-		ctx,
-		http.MethodPost,
-		removeUserToWorkspaceUrl,
-		uhttp.WithBearerToken(c.accessToken),
-		uhttp.WithJSONBody(body),
-	)
-	if err != nil {
-		return err
-	}
+// CanListAllPortfolios reports whether the portfolios of a workspace can be
+// listed without restricting them to an owner, which Asana only allows for
+// service accounts.
+func (c *Client) CanListAllPortfolios(ctx context.Context, workspaceId string) (bool, error) {
+	return c.Probe(ctx, "/portfolios", url.Values{"workspace": {workspaceId}, "limit": {"1"}})
+}
+
+// CanUseScim reports whether the SCIM provisioning API can be used.
+func (c *Client) CanUseScim(ctx context.Context) (bool, error) {
+	return c.Probe(ctx, "/scim/Users", url.Values{"count": {"1"}})
+}
 
-	resp, err := c.httpClient.Do(req)
+// SetProjectOwner transfers ownership of a project to a user.
+func (c *Client) SetProjectOwner(ctx context.Context, projectId, userId string) error {
+	_, err := c.doRequest(ctx, http.MethodPut, fmt.Sprintf("/projects/%s", projectId), nil, ownerMutationData{Owner: userId}, nil)
+	return err
+}
+
+// GetUser returns a single user, identified by gid or email.
+func (c *Client) GetUser(ctx context.Context, userId string) (User, error) {
+	q := url.Values{}
+	q.Add("opt_fields", "email,name")
+
+	var res UserResponse
+	_, err := c.doRequest(ctx, http.MethodGet, fmt.Sprintf("/users/%s", userId), q, nil, &res)
 	if err != nil {
-		return err
+		return User{}, err
 	}
-	defer resp.Body.Close()
 
-	return nil
+	return res.Data, nil
 }
 
-// AddUserToTeam adds a user to a team.
-func (c *Client) AddUserToTeam(ctx context.Context, teamId, userId string) error {
-	addUserToTeamUrl, err := getPath(BaseUrl, fmt.Sprintf("/teams/%s/addUser", teamId))
+// GetScimUser returns a single user through the SCIM API.
+func (c *Client) GetScimUser(ctx context.Context, userId string) (ScimUser, error) {
+	var res ScimUser
+	_, err := c.doRequest(ctx, http.MethodGet, fmt.Sprintf("/scim/Users/%s", userId), nil, nil, &res)
 	if err != nil {
-		return err
+		return ScimUser{}, err
 	}
 
-	body := baseMutationBody{
-		Data: struct {
-			User string `json:"user"`
-		}{
-			User: userId,
-		},
-	}
+	return res, nil
+}
 
-	req, err := c.httpClient.NewRequest(
-		ctx,
-		http.MethodPost,
-		addUserToTeamUrl,
-		uhttp.WithBearerToken(c.accessToken),
-		uhttp.WithJSONBody(body),
-	)
-	if err != nil {
-		return err
+// AllScimUsers returns an iterator over every user provisioned through the
+// SCIM API.
+func (c *Client) AllScimUsers(ctx context.Context) iter.Seq2[ScimUser, error] {
+	return func(yield func(ScimUser, error) bool) {
+		startIndex := 1
+		for {
+			q := url.Values{
+				"startIndex": {strconv.Itoa(startIndex)},
+				"count":      {strconv.Itoa(MaxPageSize)},
+			}
+
+			var res ScimListResponse[ScimUser]
+			_, err := c.doRequest(ctx, http.MethodGet, "/scim/Users", q, nil, &res)
+			if err != nil {
+				yield(ScimUser{}, err)
+				return
+			}
+
+			for _, user := range res.Resources {
+				if !yield(user, nil) {
+					return
+				}
+			}
+
+			startIndex += len(res.Resources)
+			if len(res.Resources) == 0 || startIndex > res.TotalResults {
+				return
+			}
+		}
 	}
+}
 
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return err
+// AllProjects returns an iterator over every project of a single workspace.
+func (c *Client) AllProjects(ctx context.Context, workspaceId string) iter.Seq2[Project, error] {
+	return All[Project](ctx, c, "/projects", ListOptions{
+		Query:     url.Values{"workspace": {workspaceId}},
+		OptFields: projectFields,
+	})
+}
+
+// AllPortfolios returns an iterator over the portfolios of a single workspace
+// owned by a user, or over all of them when ownerId is empty.
+func (c *Client) AllPortfolios(ctx context.Context, workspaceId, ownerId string) iter.Seq2[Portfolio, error] {
+	q := url.Values{"workspace": {workspaceId}}
+	if ownerId != "" {
+		q.Set("owner", ownerId)
 	}
-	defer resp.Body.Close()
 
-	return nil
+	return All[Portfolio](ctx, c, "/portfolios", ListOptions{
+		Query:     q,
+		OptFields: []string{"name", "owner.name"},
+	})
 }
 
-// RemoveUserToTeam removes a user to a team.
-func (c *Client) RemoveUserToTeam(ctx context.Context, teamId, userId string) error {
-	removesUserToTeamUrl, err := getPath(BaseUrl, fmt.Sprintf("/teams/%s/removeUser", teamId))
-	if err != nil {
-		return err
+// AllWorkspaceMemberships returns an iterator over every membership of a single workspace.
+func (c *Client) AllWorkspaceMemberships(ctx context.Context, workspaceId string) iter.Seq2[WorkspaceMembership, error] {
+	return All[WorkspaceMembership](ctx, c, fmt.Sprintf("/workspaces/%s/workspace_memberships", workspaceId), ListOptions{
+		OptFields: workspaceMembershipFields,
+	})
+}
+
+// AllTeams returns an iterator over every team of a single workspace.
+func (c *Client) AllTeams(ctx context.Context, workspaceId string) iter.Seq2[Team, error] {
+	return All[Team](ctx, c, fmt.Sprintf("/workspaces/%s/teams", workspaceId), ListOptions{
+		OptFields: []string{"name"},
+	})
+}
+
+// AllUserTeams returns an iterator over the teams a user is a member of in a
+// single organization.
+func (c *Client) AllUserTeams(ctx context.Context, userId, organizationId string) iter.Seq2[Team, error] {
+	return All[Team](ctx, c, fmt.Sprintf("/users/%s/teams", userId), ListOptions{
+		Query:     url.Values{"organization": {organizationId}},
+		OptFields: []string{"name"},
+	})
+}
+
+// AllMemberships returns an iterator over every membership of a single goal,
+// project, portfolio or custom field.
+func (c *Client) AllMemberships(ctx context.Context, parentId string) iter.Seq2[Membership, error] {
+	return All[Membership](ctx, c, "/memberships", ListOptions{
+		Query:     url.Values{"parent": {parentId}},
+		OptFields: []string{"parent.name", "member.name", "access_level"},
+	})
+}
+
+// AllAuditLogEvents returns an iterator over the audit log events of a
+// single type in a workspace, created at or after startAt unless it is zero.
+// It requires a service account.
+func (c *Client) AllAuditLogEvents(ctx context.Context, workspaceId, eventType string, startAt time.Time) iter.Seq2[AuditLogEvent, error] {
+	q := url.Values{"event_type": {eventType}}
+	if !startAt.IsZero() {
+		q.Set("start_at", startAt.UTC().Format(time.RFC3339))
 	}
 
-	body := baseMutationBody{
-		Data: struct {
-			User string `json:"user"`
-		}{
-			User: userId,
+	return All[AuditLogEvent](ctx, c, fmt.Sprintf("/workspaces/%s/audit_log_events", workspaceId), ListOptions{
+		Query: q,
+	})
+}
+
+// AllGoals returns an iterator over every goal of a single workspace.
+func (c *Client) AllGoals(ctx context.Context, workspaceId string) iter.Seq2[Goal, error] {
+	return All[Goal](ctx, c, "/goals", ListOptions{
+		Query:     url.Values{"workspace": {workspaceId}},
+		OptFields: []string{"name", "owner.name"},
+	})
+}
+
+// AllIncompleteTasks returns an iterator over the incomplete tasks assigned
+// to a user in a single workspace.
+func (c *Client) AllIncompleteTasks(ctx context.Context, workspaceId, assigneeId string) iter.Seq2[Task, error] {
+	return All[Task](ctx, c, "/tasks", ListOptions{
+		Query: url.Values{
+			"workspace":       {workspaceId},
+			"assignee":        {assigneeId},
+			"completed_since": {"now"},
 		},
-	}
+		OptFields: []string{"name", "completed"},
+	})
+}
 
-	req, err := c.httpClient.NewRequest(
-		ctx,
-		http.MethodPost,
-		removesUserToTeamUrl,
-		uhttp.WithBearerToken(c.accessToken),
-		uhttp.WithJSONBody(body),
-	)
-	if err != nil {
-		return err
-	}
+// GetProjectTasks returns the tasks of a single project, including their
+// followers.
+func (c *Client) GetProjectTasks(ctx context.Context, getProjectTasksVars GetProjectTasksVars) ([]Task, string, *http.Response, error) {
+	return List[Task](ctx, c, "/tasks", ListOptions{
+		Query:     url.Values{"project": {getProjectTasksVars.ProjectId}},
+		OptFields: taskFields,
+		Limit:     getProjectTasksVars.Limit,
+		Offset:    getProjectTasksVars.Offset,
+	})
+}
 
-	resp, err := c.httpClient.Do(req)
+// GetTask returns a single task, including its followers.
+func (c *Client) GetTask(ctx context.Context, taskId string) (Task, error) {
+	var res TaskResponse
+	_, err := c.doRequest(ctx, http.MethodGet, fmt.Sprintf("/tasks/%s", taskId), ListOptions{OptFields: taskFields}.query(), nil, &res)
 	if err != nil {
-		return err
+		return Task{}, err
 	}
-	defer resp.Body.Close()
 
-	return nil
+	return res.Data, nil
+}
+
+// AddPortfolioMember adds a user as member of a portfolio.
+func (c *Client) AddPortfolioMember(ctx context.Context, portfolioId, userId string) error {
+	_, err := c.doRequest(ctx, http.MethodPost, fmt.Sprintf("/portfolios/%s/addMembers", portfolioId), nil, membersMutationData{Members: userId}, nil)
+	return err
+}
+
+// SetGoalOwner transfers ownership of a goal to a user.
+func (c *Client) SetGoalOwner(ctx context.Context, goalId, userId string) error {
+	_, err := c.doRequest(ctx, http.MethodPut, fmt.Sprintf("/goals/%s", goalId), nil, ownerMutationData{Owner: userId}, nil)
+	return err
+}
+
+// SetTaskAssignee reassigns a task to a user.
+func (c *Client) SetTaskAssignee(ctx context.Context, taskId, userId string) error {
+	_, err := c.doRequest(ctx, http.MethodPut, fmt.Sprintf("/tasks/%s", taskId), nil, assigneeMutationData{Assignee: userId}, nil)
+	return err
 }
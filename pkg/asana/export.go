@@ -0,0 +1,174 @@
+package asana
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	OrganizationExportPending  = "pending"
+	OrganizationExportStarted  = "started"
+	OrganizationExportFinished = "finished"
+	OrganizationExportError    = "error"
+)
+
+// OrganizationExport is an asynchronous job exporting a whole organization.
+type OrganizationExport struct {
+	Gid          string       `json:"gid"`
+	State        string       `json:"state"`
+	DownloadUrl  string       `json:"download_url"`
+	CreatedAt    time.Time    `json:"created_at"`
+	Organization BaseResource `json:"organization"`
+}
+
+type OrganizationExportResponse struct {
+	Data OrganizationExport `json:"data"`
+}
+
+type organizationExportMutationData struct {
+	Organization string `json:"organization"`
+}
+
+// OrganizationExportData holds the users, teams and memberships read from an
+// organization export.
+type OrganizationExportData struct {
+	Users                []User
+	Teams                []Team
+	WorkspaceMemberships []WorkspaceMembership
+	// TeamMemberships holds the memberships of each team by team gid.
+	TeamMemberships map[string][]TeamMembership
+}
+
+// CreateOrganizationExport starts exporting an organization. Only Enterprise
+// service accounts can export organizations.
+func (c *Client) CreateOrganizationExport(ctx context.Context, organizationId string) (OrganizationExport, *http.Response, error) {
+	var res OrganizationExportResponse
+	resp, err := c.doRequest(ctx, http.MethodPost, "/organization_exports", nil, organizationExportMutationData{Organization: organizationId}, &res)
+	if err != nil {
+		return OrganizationExport{}, resp, err
+	}
+
+	return res.Data, resp, nil
+}
+
+// GetOrganizationExport returns the state of an organization export.
+func (c *Client) GetOrganizationExport(ctx context.Context, exportId string) (OrganizationExport, error) {
+	var res OrganizationExportResponse
+	_, err := c.doRequest(ctx, http.MethodGet, fmt.Sprintf("/organization_exports/%s", exportId), nil, nil, &res)
+	if err != nil {
+		return OrganizationExport{}, err
+	}
+
+	return res.Data, nil
+}
+
+// WaitForOrganizationExport polls an organization export every interval
+// until it is finished.
+func (c *Client) WaitForOrganizationExport(ctx context.Context, export OrganizationExport, interval time.Duration) (OrganizationExport, error) {
+	for {
+		switch export.State {
+		case OrganizationExportFinished:
+			return export, nil
+		case OrganizationExportError:
+			return export, fmt.Errorf("baton-asana: organization export %s failed", export.Gid)
+		}
+
+		select {
+		case <-ctx.Done():
+			return export, ctx.Err()
+		case <-time.After(interval):
+		}
+
+		var err error
+		export, err = c.GetOrganizationExport(ctx, export.Gid)
+		if err != nil {
+			return export, err
+		}
+	}
+}
+
+// DownloadOrganizationExport streams the result of a finished organization
+// export and parses it. The download URL is pre-signed, so it is fetched
+// without the credentials of the client.
+func (c *Client) DownloadOrganizationExport(ctx context.Context, export OrganizationExport) (*OrganizationExportData, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, export.DownloadUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.downloadClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("baton-asana: failed to download organization export %s: %s", export.Gid, resp.Status)
+	}
+
+	r, err := gzip.NewReader(bufio.NewReader(resp.Body))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return ReadOrganizationExport(r)
+}
+
+// exportObject holds the field every exported object is told apart by.
+type exportObject struct {
+	ResourceType string `json:"resource_type"`
+}
+
+// ReadOrganizationExport parses an uncompressed organization export, which is
+// a sequence of JSON objects, keeping users, teams and their memberships.
+// Objects of any other type are skipped.
+func ReadOrganizationExport(r io.Reader) (*OrganizationExportData, error) {
+	data := &OrganizationExportData{TeamMemberships: make(map[string][]TeamMembership)}
+
+	decoder := json.NewDecoder(r)
+	for {
+		var raw json.RawMessage
+		err := decoder.Decode(&raw)
+		if errors.Is(err, io.EOF) {
+			return data, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("baton-asana: malformed organization export: %w", err)
+		}
+
+		var object exportObject
+		if err := json.Unmarshal(raw, &object); err != nil {
+			return nil, fmt.Errorf("baton-asana: malformed organization export: %w", err)
+		}
+
+		switch object.ResourceType {
+		case "user":
+			var user User
+			err = json.Unmarshal(raw, &user)
+			data.Users = append(data.Users, user)
+		case "team":
+			var team Team
+			err = json.Unmarshal(raw, &team)
+			data.Teams = append(data.Teams, team)
+		case "workspace_membership":
+			var workspaceMembership WorkspaceMembership
+			err = json.Unmarshal(raw, &workspaceMembership)
+			data.WorkspaceMemberships = append(data.WorkspaceMemberships, workspaceMembership)
+		case "team_membership":
+			var teamMembership TeamMembership
+			err = json.Unmarshal(raw, &teamMembership)
+			data.TeamMemberships[teamMembership.Team.Gid] = append(data.TeamMemberships[teamMembership.Team.Gid], teamMembership)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("baton-asana: malformed %s in organization export: %w", object.ResourceType, err)
+		}
+	}
+}
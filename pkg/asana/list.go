@@ -0,0 +1,104 @@
+package asana
+
+import (
+	"context"
+	"iter"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+)
+
+// MaxPageSize is the largest page size accepted by the Asana API.
+const MaxPageSize = 100
+
+// ListOptions configures a request against a paginated Asana collection.
+type ListOptions struct {
+	// Query holds endpoint specific query parameters, e.g. a workspace filter.
+	Query url.Values
+	// OptFields lists the optional fields Asana should include on each item.
+	OptFields []string
+	Limit     int
+	Offset    string
+	// Uncached bypasses the response cache, e.g. to read back a change just
+	// made.
+	Uncached bool
+}
+
+// ListResponse is the envelope Asana wraps around every paginated collection.
+type ListResponse[T any] struct {
+	Data     []T            `json:"data"`
+	NextPage PaginationData `json:"next_page"`
+}
+
+// returns the query params for a single page request.
+func (o ListOptions) query() url.Values {
+	q := url.Values{}
+	for k, v := range o.Query {
+		q[k] = slices.Clone(v)
+	}
+	if len(o.OptFields) > 0 {
+		q.Set("opt_fields", strings.Join(o.OptFields, ","))
+	}
+	return paginationQuery(q, o.Limit, o.Offset)
+}
+
+// List returns a single page of the Asana collection at path along with the
+// offset of the next page, which is empty once the last page is reached.
+func List[T any](ctx context.Context, c *Client, path string, opts ListOptions) ([]T, string, *http.Response, error) {
+	ctxzap.Extract(ctx).Debug(
+		"baton-asana: listing page",
+		zap.String("path", path),
+		zap.String("offset", opts.Offset),
+	)
+
+	var (
+		res  ListResponse[T]
+		resp *http.Response
+		err  error
+	)
+	if opts.Uncached {
+		resp, err = c.doUncachedRequest(ctx, path, opts.query(), &res)
+	} else {
+		resp, err = c.doRequest(ctx, http.MethodGet, path, opts.query(), nil, &res)
+	}
+	if err != nil {
+		return nil, "", resp, err
+	}
+
+	return res.Data, res.NextPage.Offset, resp, nil
+}
+
+// All returns an iterator over every item of the Asana collection at path,
+// following pagination until the last page. Iteration stops at the first
+// error, which is yielded alongside the zero value of T.
+func All[T any](ctx context.Context, c *Client, path string, opts ListOptions) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		if opts.Limit == 0 {
+			opts.Limit = MaxPageSize
+		}
+
+		for {
+			items, nextOffset, _, err := List[T](ctx, c, path, opts)
+			if err != nil {
+				var zero T
+				yield(zero, err)
+				return
+			}
+
+			for _, item := range items {
+				if !yield(item, nil) {
+					return
+				}
+			}
+
+			if nextOffset == "" {
+				return
+			}
+			opts.Offset = nextOffset
+		}
+	}
+}
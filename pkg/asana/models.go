@@ -1,5 +1,11 @@
 package asana
 
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
 type BaseResource struct {
 	Gid          string `json:"gid"`
 	Name         string `json:"name"`
@@ -8,12 +14,49 @@ type BaseResource struct {
 
 type User struct {
 	BaseResource
-	Email string `json:"email"`
+	Email string     `json:"email"`
+	Photo *UserPhoto `json:"photo"`
+}
+
+// UserPhoto holds the URLs of the profile photo of a user in several sizes.
+type UserPhoto struct {
+	Image60x60     string `json:"image_60x60"`
+	Image128x128   string `json:"image_128x128"`
+	Image1024x1024 string `json:"image_1024x1024"`
+}
+
+// VacationDates is the out of office period of a workspace member, as dates
+// formatted YYYY-MM-DD. EndOn is empty when no end date is set.
+type VacationDates struct {
+	StartOn string `json:"start_on"`
+	EndOn   string `json:"end_on"`
 }
 
+// Team visibilities. Users added to request_to_join teams may only be left
+// with a pending join request.
+const (
+	TeamVisibilitySecret        = "secret"
+	TeamVisibilityRequestToJoin = "request_to_join"
+	TeamVisibilityPublic        = "public"
+)
+
 type Team struct {
 	BaseResource
-	Email string `json:"email"`
+	Email      string `json:"email"`
+	Visibility string `json:"visibility"`
+}
+
+type TeamResponse struct {
+	Data Team `json:"data"`
+}
+
+// TeamJoinRequest is a pending request of a user to join a team whose
+// visibility is request_to_join.
+type TeamJoinRequest struct {
+	Gid       string    `json:"gid"`
+	User      User      `json:"user"`
+	Team      Team      `json:"team"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 type Workspace struct {
@@ -30,6 +73,15 @@ type WorkspaceMembership struct {
 	IsActive     bool      `json:"is_active"`
 	IsAdmin      bool      `json:"is_admin"`
 	IsGuest      bool      `json:"is_guest"`
+	// IsViewOnly is set for limited access members, who are billed a
+	// cheaper seat than full members.
+	IsViewOnly    bool           `json:"is_view_only"`
+	CreatedAt     time.Time      `json:"created_at"`
+	VacationDates *VacationDates `json:"vacation_dates"`
+	// Title and Department are custom profile fields populated by
+	// Enterprise organizations.
+	Title      string `json:"title"`
+	Department string `json:"department"`
 }
 
 type PaginationData struct {
@@ -49,3 +101,184 @@ type TeamMembership struct {
 type baseMutationBody struct {
 	Data any `json:"data"`
 }
+
+type userMutationData struct {
+	User string `json:"user"`
+}
+
+type ownerMutationData struct {
+	Owner string `json:"owner"`
+}
+
+type membersMutationData struct {
+	Members string `json:"members"`
+}
+
+type assigneeMutationData struct {
+	Assignee string `json:"assignee"`
+}
+
+type ErrorDetail struct {
+	Message string `json:"message"`
+	Help    string `json:"help,omitempty"`
+	Phrase  string `json:"phrase,omitempty"`
+}
+
+// ErrorResponse is the body Asana returns for failed requests.
+type ErrorResponse struct {
+	Errors []ErrorDetail `json:"errors"`
+}
+
+var (
+	// ErrAlreadyMember is matched by errors of requests adding a user to a
+	// workspace or team they are already a member of.
+	ErrAlreadyMember = errors.New("baton-asana: user is already a member")
+	// ErrNotMember is matched by errors of requests removing a user from a
+	// workspace or team they are not a member of.
+	ErrNotMember = errors.New("baton-asana: user is not a member")
+)
+
+// alreadyMemberMessages and notMemberMessages are parts of the messages Asana
+// rejects membership changes with when there is nothing to change.
+var (
+	alreadyMemberMessages = []string{"already a member", "is already in"}
+	notMemberMessages     = []string{"not a member", "is not in"}
+)
+
+// membershipError returns ErrAlreadyMember or ErrNotMember when the errors
+// report that a membership change has nothing to change, and nil otherwise.
+func (e *ErrorResponse) membershipError() error {
+	for _, detail := range e.Errors {
+		message := strings.ToLower(detail.Message)
+		for _, m := range alreadyMemberMessages {
+			if strings.Contains(message, m) {
+				return ErrAlreadyMember
+			}
+		}
+		for _, m := range notMemberMessages {
+			if strings.Contains(message, m) {
+				return ErrNotMember
+			}
+		}
+	}
+	return nil
+}
+
+func (e *ErrorResponse) Message() string {
+	messages := make([]string, 0, len(e.Errors))
+	for _, detail := range e.Errors {
+		messages = append(messages, detail.Message)
+	}
+	return strings.Join(messages, "; ")
+}
+
+type CustomField struct {
+	BaseResource
+	ResourceSubtype     string `json:"resource_subtype"`
+	Description         string `json:"description"`
+	IsGlobalToWorkspace bool   `json:"is_global_to_workspace"`
+	PrivacySetting      string `json:"privacy_setting"`
+	CreatedBy           *User  `json:"created_by"`
+}
+
+// Membership is a goal, project, portfolio or custom field membership. Its
+// member is either a user or a team.
+type Membership struct {
+	Gid          string       `json:"gid"`
+	ResourceType string       `json:"resource_type"`
+	Parent       BaseResource `json:"parent"`
+	Member       BaseResource `json:"member"`
+	AccessLevel  string       `json:"access_level"`
+}
+
+type Project struct {
+	BaseResource
+	Archived       bool         `json:"archived"`
+	PrivacySetting string       `json:"privacy_setting"`
+	Owner          *User        `json:"owner"`
+	Team           *Team        `json:"team"`
+	Workspace      BaseResource `json:"workspace"`
+}
+
+// ProjectTemplate is a template new projects are created from. The roles it
+// requests are assigned to users when a project is created from it.
+type ProjectTemplate struct {
+	BaseResource
+	Description    string         `json:"description"`
+	Public         bool           `json:"public"`
+	Owner          *User          `json:"owner"`
+	Team           *Team          `json:"team"`
+	RequestedRoles []BaseResource `json:"requested_roles"`
+}
+
+type Portfolio struct {
+	BaseResource
+	Public    bool         `json:"public"`
+	Owner     *User        `json:"owner"`
+	Workspace BaseResource `json:"workspace"`
+}
+
+type Goal struct {
+	BaseResource
+	Owner *User `json:"owner"`
+}
+
+type Task struct {
+	BaseResource
+	Completed bool   `json:"completed"`
+	Assignee  *User  `json:"assignee"`
+	Followers []User `json:"followers"`
+}
+
+type TaskResponse struct {
+	Data Task `json:"data"`
+}
+
+type ScimManager struct {
+	Value string `json:"value"`
+}
+
+type ScimEnterpriseUser struct {
+	Department string       `json:"department"`
+	Manager    *ScimManager `json:"manager"`
+}
+
+// ScimUser is a user as returned by the Asana SCIM API, whose id is the
+// gid of the user.
+type ScimUser struct {
+	Id         string              `json:"id"`
+	UserName   string              `json:"userName"`
+	Active     bool                `json:"active"`
+	Title      string              `json:"title"`
+	Enterprise *ScimEnterpriseUser `json:"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User"`
+}
+
+// ScimListResponse is a page of a SCIM collection. StartIndex is 1-based.
+type ScimListResponse[T any] struct {
+	TotalResults int `json:"totalResults"`
+	ItemsPerPage int `json:"itemsPerPage"`
+	StartIndex   int `json:"startIndex"`
+	Resources    []T `json:"Resources"`
+}
+
+type AuditLogActor struct {
+	ActorType string `json:"actor_type"`
+	Gid       string `json:"gid"`
+	Name      string `json:"name"`
+	Email     string `json:"email"`
+}
+
+type AuditLogResource struct {
+	Gid          string `json:"gid"`
+	Name         string `json:"name"`
+	Email        string `json:"email"`
+	ResourceType string `json:"resource_type"`
+}
+
+type AuditLogEvent struct {
+	Gid       string           `json:"gid"`
+	CreatedAt time.Time        `json:"created_at"`
+	EventType string           `json:"event_type"`
+	Actor     AuditLogActor    `json:"actor"`
+	Resource  AuditLogResource `json:"resource"`
+}
@@ -0,0 +1,88 @@
+package asana
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	// WebhookSecretHeader carries the secret Asana hands over when
+	// establishing a webhook, which must be echoed back.
+	WebhookSecretHeader = "X-Hook-Secret"
+	// WebhookSignatureHeader carries the hex encoded HMAC-SHA256 of each
+	// delivery body, keyed with the webhook secret.
+	WebhookSignatureHeader = "X-Hook-Signature"
+)
+
+type WebhookFilter struct {
+	ResourceType string `json:"resource_type"`
+	Action       string `json:"action,omitempty"`
+}
+
+type Webhook struct {
+	Gid      string       `json:"gid"`
+	Active   bool         `json:"active"`
+	Resource BaseResource `json:"resource"`
+	Target   string       `json:"target"`
+}
+
+type WebhookResponse struct {
+	Data Webhook `json:"data"`
+}
+
+// WebhookEvent is a single change delivered to a webhook. Events are compact
+// and only reference the changed resource and its parent.
+type WebhookEvent struct {
+	User      *BaseResource `json:"user"`
+	CreatedAt time.Time     `json:"created_at"`
+	Action    string        `json:"action"`
+	Resource  BaseResource  `json:"resource"`
+	Parent    *BaseResource `json:"parent"`
+}
+
+// WebhookDelivery is the body of a request Asana sends to a webhook target.
+type WebhookDelivery struct {
+	Events []WebhookEvent `json:"events"`
+}
+
+type webhookMutationData struct {
+	Resource string          `json:"resource"`
+	Target   string          `json:"target"`
+	Filters  []WebhookFilter `json:"filters,omitempty"`
+}
+
+// CreateWebhook registers a webhook delivering changes of a resource to
+// target. Asana performs the handshake with target before responding, so it
+// must already be served.
+func (c *Client) CreateWebhook(ctx context.Context, resourceId, target string, filters []WebhookFilter) (Webhook, error) {
+	var res WebhookResponse
+	_, err := c.doRequest(ctx, http.MethodPost, "/webhooks", nil, webhookMutationData{
+		Resource: resourceId,
+		Target:   target,
+		Filters:  filters,
+	}, &res)
+	if err != nil {
+		return Webhook{}, err
+	}
+
+	return res.Data, nil
+}
+
+// AllWebhooks returns an iterator over the webhooks registered in a workspace
+// by the authenticated principal.
+func (c *Client) AllWebhooks(ctx context.Context, workspaceId string) iter.Seq2[Webhook, error] {
+	return All[Webhook](ctx, c, "/webhooks", ListOptions{
+		Query:     url.Values{"workspace": {workspaceId}},
+		OptFields: []string{"active", "resource.name", "target"},
+	})
+}
+
+// DeleteWebhook removes a webhook.
+func (c *Client) DeleteWebhook(ctx context.Context, webhookId string) error {
+	_, err := c.doRequest(ctx, http.MethodDelete, fmt.Sprintf("/webhooks/%s", webhookId), nil, nil, nil)
+	return err
+}
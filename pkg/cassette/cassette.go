@@ -0,0 +1,390 @@
+package cassette
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Redacted replaces every redacted value in a cassette.
+const Redacted = "REDACTED"
+
+// secretFields are always redacted from bodies, on top of the configured
+// fields, since they hold credentials.
+var secretFields = []string{"access_token", "refresh_token", "client_secret", "password", "download_url"}
+
+// urlFields hold pre-signed URLs, which are credentials themselves. Requests
+// to URLs redacted from these fields are recorded with a redacted URL, which
+// is the URL requested when replaying the redacted body.
+var urlFields = []string{"download_url"}
+
+// recordedHeaders lists the response headers kept in a cassette. Other
+// headers are dropped as the connector does not depend on them.
+var recordedHeaders = []string{"Content-Type", "Retry-After", "X-Asana-Request-Id"}
+
+// Interaction is a single request and its response, stored as one JSON line
+// in a cassette.
+type Interaction struct {
+	Method          string              `json:"method"`
+	URL             string              `json:"url"`
+	RequestHeaders  map[string][]string `json:"request_headers,omitempty"`
+	RequestBody     string              `json:"request_body,omitempty"`
+	StatusCode      int                 `json:"status_code"`
+	ResponseHeaders map[string][]string `json:"response_headers,omitempty"`
+	ResponseBody    string              `json:"response_body,omitempty"`
+	// ResponseBodyBase64 is set for binary response bodies, e.g. exports,
+	// which are stored base64 encoded.
+	ResponseBodyBase64 bool `json:"response_body_base64,omitempty"`
+}
+
+// redactor removes credentials and the values of configured fields from
+// recorded interactions.
+type redactor struct {
+	fields map[string]bool
+
+	mu         sync.Mutex
+	secretUrls map[string]bool
+}
+
+func newRedactor(fields []string) *redactor {
+	r := &redactor{
+		fields:     make(map[string]bool),
+		secretUrls: make(map[string]bool),
+	}
+	for _, f := range fields {
+		r.fields[strings.ToLower(f)] = true
+	}
+	for _, f := range secretFields {
+		r.fields[f] = true
+	}
+	return r
+}
+
+// body redacts the fields of a JSON or form encoded body. Other bodies are
+// returned as is.
+func (r *redactor) body(contentType string, body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+
+	if strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			return string(body)
+		}
+		for k := range values {
+			if r.fields[strings.ToLower(k)] {
+				values.Set(k, Redacted)
+			}
+		}
+		return values.Encode()
+	}
+
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return string(body)
+	}
+	redacted, err := json.Marshal(r.value(v))
+	if err != nil {
+		return string(body)
+	}
+	return string(redacted)
+}
+
+func (r *redactor) value(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, field := range v {
+			if r.fields[strings.ToLower(k)] {
+				if value, ok := field.(string); ok {
+					if slices.Contains(urlFields, strings.ToLower(k)) {
+						r.mu.Lock()
+						r.secretUrls[value] = true
+						r.mu.Unlock()
+					}
+					v[k] = Redacted
+					continue
+				}
+			}
+			v[k] = r.value(field)
+		}
+		return v
+	case []interface{}:
+		for i := range v {
+			v[i] = r.value(v[i])
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// url redacts the configured fields from the query of a URL, and email
+// addresses from its path when emails are redacted, e.g. users looked up by
+// email. URLs redacted from the body of an earlier response are redacted as a
+// whole.
+func (r *redactor) url(u *url.URL) string {
+	r.mu.Lock()
+	secret := r.secretUrls[u.String()]
+	r.mu.Unlock()
+	if secret {
+		return Redacted
+	}
+
+	redacted := *u
+	if r.fields["email"] {
+		segments := strings.Split(redacted.Path, "/")
+		for i, segment := range segments {
+			if strings.Contains(segment, "@") {
+				segments[i] = Redacted
+			}
+		}
+		redacted.Path = strings.Join(segments, "/")
+		redacted.RawPath = ""
+	}
+
+	query := redacted.Query()
+	for k := range query {
+		if r.fields[strings.ToLower(k)] {
+			query.Set(k, Redacted)
+		}
+	}
+	if len(query) > 0 {
+		redacted.RawQuery = query.Encode()
+	}
+
+	return redacted.String()
+}
+
+func (r *redactor) request(req *http.Request, body []byte) Interaction {
+	interaction := Interaction{
+		Method:      req.Method,
+		URL:         r.url(req.URL),
+		RequestBody: r.body(req.Header.Get("Content-Type"), body),
+	}
+	if req.Header.Get("Authorization") != "" {
+		interaction.RequestHeaders = map[string][]string{"Authorization": {Redacted}}
+	}
+	return interaction
+}
+
+func readBody(body io.ReadCloser) ([]byte, error) {
+	if body == nil || body == http.NoBody {
+		return nil, nil
+	}
+	defer body.Close()
+	return io.ReadAll(body)
+}
+
+// Recorder writes the interactions of the transports it wraps to a cassette.
+type Recorder struct {
+	redactor *redactor
+
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewRecorder returns a recorder writing interactions to w, redacting the
+// values of the given JSON and form fields.
+func NewRecorder(w io.Writer, redactFields []string) *Recorder {
+	return &Recorder{
+		redactor: newRedactor(redactFields),
+		w:        w,
+	}
+}
+
+// Close syncs the cassette to disk and closes it, when it is written to a
+// file or another closer.
+func (rec *Recorder) Close() error {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	var err error
+	if s, ok := rec.w.(interface{ Sync() error }); ok {
+		err = s.Sync()
+	}
+	if c, ok := rec.w.(io.Closer); ok {
+		err = errors.Join(err, c.Close())
+	}
+	return err
+}
+
+// Transport returns an http.RoundTripper recording every interaction of next.
+func (rec *Recorder) Transport(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &recordingTransport{recorder: rec, next: next}
+}
+
+type recordingTransport struct {
+	recorder *Recorder
+	next     http.RoundTripper
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	reqBody, err := readBody(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	if reqBody != nil {
+		req.Body = io.NopCloser(bytes.NewReader(reqBody))
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	respBody, err := readBody(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	rec := t.recorder
+	interaction := rec.redactor.request(req, reqBody)
+	interaction.StatusCode = resp.StatusCode
+	if utf8.Valid(respBody) {
+		interaction.ResponseBody = rec.redactor.body(resp.Header.Get("Content-Type"), respBody)
+	} else {
+		interaction.ResponseBody = base64.StdEncoding.EncodeToString(respBody)
+		interaction.ResponseBodyBase64 = true
+	}
+	for _, h := range recordedHeaders {
+		if values := resp.Header.Values(h); len(values) > 0 {
+			if interaction.ResponseHeaders == nil {
+				interaction.ResponseHeaders = make(map[string][]string)
+			}
+			interaction.ResponseHeaders[h] = values
+		}
+	}
+
+	line, err := json.Marshal(interaction)
+	if err != nil {
+		return nil, err
+	}
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if _, err := rec.w.Write(append(line, '\n')); err != nil {
+		return nil, fmt.Errorf("baton-asana: failed to write cassette: %w", err)
+	}
+
+	return resp, nil
+}
+
+// Replayer is an http.RoundTripper serving responses from a cassette without
+// any network access. Requests are matched on method, redacted URL and
+// redacted body, and identical requests are served their recorded responses
+// in order.
+type Replayer struct {
+	redactor *redactor
+
+	mu           sync.Mutex
+	interactions map[string][]Interaction
+}
+
+// NewReplayer returns a transport replaying the cassette read from r. The
+// redacted fields must match those the cassette was recorded with.
+func NewReplayer(r io.Reader, redactFields []string) (*Replayer, error) {
+	rep := &Replayer{
+		redactor:     newRedactor(redactFields),
+		interactions: make(map[string][]Interaction),
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var interaction Interaction
+		if err := json.Unmarshal(scanner.Bytes(), &interaction); err != nil {
+			return nil, fmt.Errorf("baton-asana: malformed cassette: %w", err)
+		}
+		key := interactionKey(interaction)
+		rep.interactions[key] = append(rep.interactions[key], interaction)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return rep, nil
+}
+
+// LoadReplayer returns a transport replaying the cassette at path.
+func LoadReplayer(path string, redactFields []string) (*Replayer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return NewReplayer(f, redactFields)
+}
+
+func interactionKey(interaction Interaction) string {
+	return strings.Join([]string{interaction.Method, interaction.URL, interaction.RequestBody}, " ")
+}
+
+func (rep *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	reqBody, err := readBody(req.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	key := interactionKey(rep.redactor.request(req, reqBody))
+
+	rep.mu.Lock()
+	queue := rep.interactions[key]
+	if len(queue) == 0 {
+		rep.mu.Unlock()
+		return nil, fmt.Errorf("baton-asana: no recorded response for %s %s", req.Method, req.URL)
+	}
+	interaction := queue[0]
+	// The last response of a request keeps being served once the recorded
+	// ones are used up, e.g. for requests retried more often than recorded.
+	if len(queue) > 1 {
+		rep.interactions[key] = queue[1:]
+	}
+	rep.mu.Unlock()
+
+	body := []byte(interaction.ResponseBody)
+	if interaction.ResponseBodyBase64 {
+		body, err = base64.StdEncoding.DecodeString(interaction.ResponseBody)
+		if err != nil {
+			return nil, fmt.Errorf("baton-asana: malformed cassette body for %s %s: %w", req.Method, req.URL, err)
+		}
+	}
+
+	header := make(http.Header)
+	for k, values := range interaction.ResponseHeaders {
+		for _, v := range values {
+			header.Add(k, v)
+		}
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", interaction.StatusCode, http.StatusText(interaction.StatusCode)),
+		StatusCode:    interaction.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
@@ -0,0 +1,123 @@
+package cassette
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const (
+	testEmail       = "jane@example.com"
+	testSignature   = "signature-1234"
+	testAccessToken = "access-token-1234"
+	testExport      = "export payload"
+)
+
+// newTestAPI serves a user looked up by email, an export pointing at a
+// pre-signed download URL, the download itself and an OAuth token exchange.
+func newTestAPI(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/users/"+testEmail && r.URL.Query().Get("email") == testEmail:
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = io.WriteString(w, `{"data":{"gid":"1","name":"Jane","email":"`+testEmail+`"}}`)
+		case r.URL.Path == "/exports/1":
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = io.WriteString(w, `{"data":{"gid":"1","download_url":"`+ts.URL+`/download?X-Amz-Signature=`+testSignature+`"}}`)
+		case r.URL.Path == "/download" && r.URL.Query().Get("X-Amz-Signature") == testSignature:
+			_, _ = io.WriteString(w, testExport)
+		case r.URL.Path == "/oauth_token":
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = io.WriteString(w, `{"access_token":"`+testAccessToken+`","expires_in":3600}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(ts.Close)
+
+	return ts
+}
+
+// get requests rawUrl and returns the response body.
+func get(t *testing.T, client *http.Client, rawUrl string) string {
+	t.Helper()
+
+	resp, err := client.Get(rawUrl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s: status %d", rawUrl, resp.StatusCode)
+	}
+
+	return string(body)
+}
+
+// run performs the requests of a sync against baseUrl and returns the body of
+// the last response, the export download.
+func run(t *testing.T, client *http.Client, baseUrl string) string {
+	t.Helper()
+
+	get(t, client, baseUrl+"/users/"+testEmail+"?email="+url.QueryEscape(testEmail))
+
+	resp, err := client.PostForm(baseUrl+"/oauth_token", url.Values{"refresh_token": {"refresh-token-1234"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	var export struct {
+		Data struct {
+			DownloadUrl string `json:"download_url"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(get(t, client, baseUrl+"/exports/1")), &export); err != nil {
+		t.Fatal(err)
+	}
+
+	return get(t, client, export.Data.DownloadUrl)
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	api := newTestAPI(t)
+	redactFields := []string{"email"}
+
+	var cassette bytes.Buffer
+	recorder := NewRecorder(&cassette, redactFields)
+	recorded := run(t, &http.Client{Transport: recorder.Transport(nil)}, api.URL)
+	if recorded != testExport {
+		t.Fatalf("recorded export = %q, want %q", recorded, testExport)
+	}
+
+	for _, secret := range []string{testEmail, url.QueryEscape(testEmail), testSignature, testAccessToken, "refresh-token-1234"} {
+		if strings.Contains(cassette.String(), secret) {
+			t.Errorf("cassette contains %q:\n%s", secret, cassette.String())
+		}
+	}
+
+	// Replaying must not depend on the API.
+	api.Close()
+
+	replayer, err := NewReplayer(bytes.NewReader(cassette.Bytes()), redactFields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayed := run(t, &http.Client{Transport: replayer}, api.URL)
+	if replayed != testExport {
+		t.Fatalf("replayed export = %q, want %q", replayed, testExport)
+	}
+}
@@ -0,0 +1,150 @@
+package connector
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/conductorone/baton-asana/pkg/asana"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+)
+
+// auditLogUserLoginSucceeded is the audit log event recorded each time a user
+// logs in, with the user as actor.
+const auditLogUserLoginSucceeded = "user_login_succeeded"
+
+// lastLoginLookback is how far back logins are read from the audit log when
+// dormancy detection is disabled or looks back less far.
+const lastLoginLookback = 90 * 24 * time.Hour
+
+// activityDirectory collects, per workspace, the last login of each user from
+// the audit log, and flags members without any activity for longer than
+// dormantAfter as dormant. Workspaces are loaded lazily the first time one of
+// their memberships is listed.
+type activityDirectory struct {
+	client       *asana.Client
+	capabilities *capabilities
+	// dormantAfter is the time without activity after which a member is
+	// dormant. Zero disables dormancy detection.
+	dormantAfter time.Duration
+
+	mu         sync.Mutex
+	workspaces map[string]map[string]time.Time
+}
+
+func newActivityDirectory(client *asana.Client, caps *capabilities, dormantAfterDays int) *activityDirectory {
+	return &activityDirectory{
+		client:       client,
+		capabilities: caps,
+		dormantAfter: time.Duration(dormantAfterDays) * 24 * time.Hour,
+		workspaces:   make(map[string]map[string]time.Time),
+	}
+}
+
+// lastLogins returns the last login of each user of a workspace within the
+// lookback, loading them on first use. Logins are only read as far back as
+// the longer of lastLoginLookback and the dormancy period, since members
+// without a login inside the dormancy period are dormant however long ago
+// they last logged in. It returns nil when the audit log cannot be read, in
+// which case nothing is known about logins.
+func (d *activityDirectory) lastLogins(ctx context.Context, workspaceId string) (map[string]time.Time, error) {
+	if d == nil || !d.capabilities.hasAuditLog() {
+		return nil, nil
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if logins, ok := d.workspaces[workspaceId]; ok {
+		return logins, nil
+	}
+
+	startAt := time.Now().Add(-max(d.dormantAfter, lastLoginLookback))
+
+	logins := make(map[string]time.Time)
+	for event, err := range d.client.AllAuditLogEvents(ctx, workspaceId, auditLogUserLoginSucceeded, startAt) {
+		if err != nil {
+			return nil, err
+		}
+		if event.Actor.Gid == "" {
+			continue
+		}
+		if event.CreatedAt.After(logins[event.Actor.Gid]) {
+			logins[event.Actor.Gid] = event.CreatedAt
+		}
+	}
+
+	ctxzap.Extract(ctx).Debug(
+		"baton-asana: loaded last logins",
+		zap.String("workspace_id", workspaceId),
+		zap.Time("start_at", startAt),
+		zap.Int("users", len(logins)),
+	)
+
+	d.workspaces[workspaceId] = logins
+
+	return logins, nil
+}
+
+// memberActivity is what is known about the activity of a workspace member.
+type memberActivity struct {
+	createdAt time.Time
+	lastLogin time.Time
+	// known is set when logins are read from the audit log, so that a missing
+	// last login means the member did not log in within the lookback.
+	known bool
+}
+
+// member returns the activity of a member of a workspace.
+func (d *activityDirectory) member(ctx context.Context, workspaceId string, workspaceMembership *asana.WorkspaceMembership) (memberActivity, error) {
+	activity := memberActivity{createdAt: workspaceMembership.CreatedAt}
+
+	logins, err := d.lastLogins(ctx, workspaceId)
+	if err != nil {
+		return activity, err
+	}
+	if logins != nil {
+		activity.known = true
+		activity.lastLogin = logins[workspaceMembership.User.Gid]
+	}
+
+	return activity, nil
+}
+
+// dormant reports whether a member has not been active for longer than the
+// configured period. Members are never dormant when dormancy detection is
+// disabled or their logins are unknown. The creation of the membership counts
+// as activity, so that newly invited members are not flagged.
+func (d *activityDirectory) dormant(activity memberActivity) (bool, bool) {
+	if d == nil || d.dormantAfter <= 0 || !activity.known {
+		return false, false
+	}
+
+	lastActive := activity.lastLogin
+	if activity.createdAt.After(lastActive) {
+		lastActive = activity.createdAt
+	}
+	if lastActive.IsZero() {
+		return false, false
+	}
+
+	return time.Since(lastActive) > d.dormantAfter, true
+}
+
+// metadata returns the activity of a member as profile fields and grant
+// metadata.
+func (d *activityDirectory) metadata(activity memberActivity) map[string]interface{} {
+	metadata := make(map[string]interface{})
+	if !activity.createdAt.IsZero() {
+		metadata["created_at"] = activity.createdAt.Format(time.RFC3339)
+	}
+	if !activity.lastLogin.IsZero() {
+		metadata["last_login"] = activity.lastLogin.Format(time.RFC3339)
+	}
+	if dormant, ok := d.dormant(activity); ok {
+		metadata["dormant"] = dormant
+	}
+
+	return metadata
+}
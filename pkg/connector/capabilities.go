@@ -0,0 +1,243 @@
+package connector
+
+import (
+	"context"
+	"sync"
+
+	"github.com/conductorone/baton-asana/pkg/asana"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// capabilities describes what the configured credentials are allowed to do.
+type capabilities struct {
+	mu       sync.RWMutex
+	detected bool
+
+	ServiceAccount  bool
+	ReadMemberships bool
+	// WorkspaceAdmin is set when the principal administers a workspace it
+	// is not a guest of. It is read from the workspace memberships rather
+	// than probed, since Asana cannot be asked whether users may be added
+	// short of adding one.
+	WorkspaceAdmin bool
+	AuditLog       bool
+	Scim           bool
+	// NoJoinRequests is set once listing team join requests was found to be
+	// unavailable, so that it is not attempted for every team.
+	NoJoinRequests bool
+	// NoCustomFieldMemberships holds the ids of the workspaces whose plan
+	// was found to lack custom field memberships, so that they are not
+	// listed for every custom field.
+	NoCustomFieldMemberships map[string]bool
+}
+
+// detect probes the Asana API for the capabilities of the credentials using
+// the workspace memberships of the authenticated principal. Service accounts
+// are told apart from personal access tokens by listing portfolios without an
+// owner, which Asana only allows for service accounts. Whether members can be
+// managed is not probed but inferred from the principal being a workspace
+// admin. A probe that fails is logged and its capability is considered
+// missing, so that a transient failure does not fail validation.
+func (c *capabilities) detect(ctx context.Context, client *asana.Client, workspaceMemberships []asana.WorkspaceMembership) {
+	l := ctxzap.Extract(ctx)
+
+	probe := func(name, workspaceId string, fn func(ctx context.Context) (bool, error)) bool {
+		ok, err := fn(ctx)
+		if err != nil {
+			l.Warn(
+				"baton-asana: failed to probe capability",
+				zap.String("capability", name),
+				zap.String("workspace_id", workspaceId),
+				zap.Error(err),
+			)
+			return false
+		}
+		return ok
+	}
+
+	var serviceAccount, readMemberships, auditLog, isAdmin bool
+	for _, workspaceMembership := range workspaceMemberships {
+		if workspaceMembership.IsGuest {
+			continue
+		}
+		workspaceId := workspaceMembership.Workspace.Gid
+
+		if workspaceMembership.IsAdmin {
+			isAdmin = true
+		}
+
+		if !serviceAccount {
+			serviceAccount = probe("service_account", workspaceId, func(ctx context.Context) (bool, error) {
+				return client.CanListAllPortfolios(ctx, workspaceId)
+			})
+		}
+
+		if !readMemberships {
+			readMemberships = probe("read_memberships", workspaceId, func(ctx context.Context) (bool, error) {
+				return client.CanReadWorkspaceMemberships(ctx, workspaceId)
+			})
+		}
+
+		if !auditLog {
+			auditLog = probe("audit_log", workspaceId, func(ctx context.Context) (bool, error) {
+				return client.CanReadAuditLog(ctx, workspaceId)
+			})
+		}
+	}
+
+	scim := probe("scim", "", client.CanUseScim)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.detected = true
+	c.ServiceAccount = serviceAccount
+	c.ReadMemberships = readMemberships
+	c.WorkspaceAdmin = isAdmin
+	c.AuditLog = auditLog
+	c.Scim = scim
+}
+
+// profile returns the detected capabilities in a form suitable for connector metadata.
+func (c *capabilities) profile() map[string]interface{} {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if !c.detected {
+		return nil
+	}
+
+	return map[string]interface{}{
+		"service_account": c.ServiceAccount,
+		// Asana does not expose the plan of an organization, but only
+		// Enterprise organizations offer the audit log and SCIM.
+		"enterprise": c.AuditLog || c.Scim,
+		// Workspace admins are assumed to be able to manage members, which
+		// is inferred rather than probed.
+		"workspace_admin": c.WorkspaceAdmin,
+		"capabilities": map[string]interface{}{
+			"read_memberships": c.ReadMemberships,
+			"audit_log":        c.AuditLog,
+			"scim":             c.Scim,
+		},
+	}
+}
+
+// canProvision returns an error when the principal is not a workspace admin,
+// which managing workspace and team members is assumed to require.
+func (c *capabilities) canProvision() error {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.detected && !c.WorkspaceAdmin {
+		return status.Error(codes.PermissionDenied, "baton-asana: the configured credentials are not a workspace admin and are assumed unable to manage workspace or team members")
+	}
+
+	return nil
+}
+
+// isServiceAccount reports whether the credentials belong to a service account.
+func (c *capabilities) isServiceAccount() bool {
+	if c == nil {
+		return false
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.ServiceAccount
+}
+
+// hasAuditLog reports whether the credentials can read the audit log.
+func (c *capabilities) hasAuditLog() bool {
+	if c == nil {
+		return false
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.AuditLog
+}
+
+// canReadMemberships reports whether the credentials can list workspace
+// memberships. It assumes they can until detected otherwise.
+func (c *capabilities) canReadMemberships() bool {
+	if c == nil {
+		return true
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return !c.detected || c.ReadMemberships
+}
+
+// canUseScim reports whether the credentials can use the SCIM API.
+func (c *capabilities) canUseScim() bool {
+	if c == nil {
+		return false
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Scim
+}
+
+// canReadJoinRequests reports whether team join requests can be listed. It
+// assumes they can until a listing failed.
+func (c *capabilities) canReadJoinRequests() bool {
+	if c == nil {
+		return true
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return !c.NoJoinRequests
+}
+
+// canReadCustomFieldMemberships reports whether the memberships of custom
+// fields in a workspace can be listed. It assumes they can until a listing
+// failed for the plan of the workspace.
+func (c *capabilities) canReadCustomFieldMemberships(workspaceId string) bool {
+	if c == nil {
+		return true
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return !c.NoCustomFieldMemberships[workspaceId]
+}
+
+// disableCustomFieldMemberships records that the plan of a workspace lacks
+// custom field memberships. It reports whether this was not known yet.
+func (c *capabilities) disableCustomFieldMemberships(workspaceId string) bool {
+	if c == nil {
+		return true
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.NoCustomFieldMemberships[workspaceId] {
+		return false
+	}
+	if c.NoCustomFieldMemberships == nil {
+		c.NoCustomFieldMemberships = make(map[string]bool)
+	}
+	c.NoCustomFieldMemberships[workspaceId] = true
+	return true
+}
+
+// disableJoinRequests records that team join requests cannot be listed.
+func (c *capabilities) disableJoinRequests() {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.NoJoinRequests = true
+}
@@ -3,13 +3,21 @@ package connector
 import (
 	"context"
 	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
 
 	"github.com/conductorone/baton-asana/pkg/asana"
+	"github.com/conductorone/baton-asana/pkg/cassette"
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
 	"github.com/conductorone/baton-sdk/pkg/annotations"
 	"github.com/conductorone/baton-sdk/pkg/connectorbuilder"
 	"github.com/conductorone/baton-sdk/pkg/uhttp"
 	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/types/known/structpb"
 )
 
 var allowedWorkspaces []string
@@ -36,58 +44,381 @@ var (
 			v2.ResourceType_TRAIT_GROUP,
 		},
 	}
+	resourceTypeProject = &v2.ResourceType{
+		Id:          "project",
+		DisplayName: "Project",
+		Traits: []v2.ResourceType_Trait{
+			v2.ResourceType_TRAIT_GROUP,
+		},
+	}
+	resourceTypePortfolio = &v2.ResourceType{
+		Id:          "portfolio",
+		DisplayName: "Portfolio",
+		Traits: []v2.ResourceType_Trait{
+			v2.ResourceType_TRAIT_GROUP,
+		},
+	}
+	resourceTypeCustomField = &v2.ResourceType{
+		Id:          "custom_field",
+		DisplayName: "Custom Field",
+	}
+	resourceTypeTask = &v2.ResourceType{
+		Id:          "task",
+		DisplayName: "Task",
+	}
+	resourceTypeProjectTemplate = &v2.ResourceType{
+		Id:          "project_template",
+		DisplayName: "Project Template",
+		Traits: []v2.ResourceType_Trait{
+			v2.ResourceType_TRAIT_GROUP,
+		},
+	}
 )
 
 type Asana struct {
 	client            *asana.Client
 	allowedWorkspaces *[]string
+	capabilities      *capabilities
+	prefetchWorkers   int
+	offboarder        *offboarder
+	guests            *guestDirectory
+	sensitiveProjects []string
+	taskPageLimit     int
+	export            *orgExportSource
+	scim              *scimDirectory
+	activity          *activityDirectory
+	resourceTypes     *resourceTypeSelection
+	// cassette is the cassette requests are recorded to, if any.
+	cassette io.Closer
+
+	mu sync.Mutex
+	// identity is looked up once, by Validate or the first call to
+	// Metadata.
+	identity *identity
 }
 
-func (as *Asana) ResourceSyncers(ctx context.Context) []connectorbuilder.ResourceSyncer {
-	return []connectorbuilder.ResourceSyncer{
-		userBuilder(as.client),
-		workspaceBuilder(as.client, as.allowedWorkspaces),
-		teamBuilder(as.client),
+// identity is the principal the credentials authenticate as, along with the
+// workspaces it belongs to.
+type identity struct {
+	principal            asana.User
+	workspaceMemberships []asana.WorkspaceMembership
+}
+
+// authenticate looks up the identity of the credentials and detects their
+// capabilities, once. Failed lookups are retried by the next call.
+func (as *Asana) authenticate(ctx context.Context) (*identity, error) {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+
+	if as.identity != nil {
+		return as.identity, nil
+	}
+
+	workspaceMemberships, err := as.client.AuthCheck(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	principal, err := as.client.GetCurrentUser(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up the authenticated principal: %w", err)
+	}
+
+	as.capabilities.detect(ctx, as.client, workspaceMemberships)
+
+	as.identity = &identity{
+		principal:            principal,
+		workspaceMemberships: workspaceMemberships,
 	}
+	return as.identity, nil
+}
+
+func (as *Asana) ResourceSyncers(ctx context.Context) []connectorbuilder.ResourceSyncer {
+	return as.resourceTypes.apply(ctx, []connectorbuilder.ResourceSyncer{
+		userBuilder(as.client, as.capabilities, as.guests, as.export, as.scim, as.activity),
+		workspaceBuilder(as.client, as.allowedWorkspaces, as.capabilities, as.offboarder, as.export, as.activity),
+		teamBuilder(as.client, as.capabilities, as.prefetchWorkers, as.export, as.guests),
+		projectBuilder(as.client, as.sensitiveProjects, as.guests),
+		portfolioBuilder(as.client, as.capabilities, as.guests),
+		customFieldBuilder(as.client, as.capabilities),
+		taskBuilder(as.client, as.sensitiveProjects, as.taskPageLimit),
+		projectTemplateBuilder(as.client),
+	})
 }
 
-// Metadata returns metadata about the connector.
+// Metadata returns metadata about the connector, including the principal
+// the credentials authenticate as, the workspaces in scope, the capabilities
+// detected for the credentials and the enabled features. The principal and
+// capabilities are looked up once and reused by later calls.
 func (as *Asana) Metadata(ctx context.Context) (*v2.ConnectorMetadata, error) {
-	return &v2.ConnectorMetadata{
+	md := &v2.ConnectorMetadata{
 		DisplayName: "Asana",
-		Description: "Connector syncing users, teams and workspaces from Asana to Baton",
-	}, nil
+		Description: "Connector syncing users, teams, workspaces, projects, project templates, portfolios, custom fields and tasks of sensitive projects from Asana to Baton",
+	}
+
+	id, err := as.authenticate(ctx)
+	if err != nil {
+		ctxzap.Extract(ctx).Warn("baton-asana: failed to authenticate", zap.Error(err))
+		return md, nil
+	}
+
+	profile := as.capabilities.profile()
+	profile["principal"] = map[string]interface{}{
+		"id":    id.principal.Gid,
+		"name":  id.principal.Name,
+		"email": id.principal.Email,
+	}
+	profile["workspaces"] = workspacesProfile(id.workspaceMemberships)
+	profile["features"] = as.features()
+
+	mdProfile, err := structpb.NewStruct(profile)
+	if err != nil {
+		return nil, err
+	}
+	md.Profile = mdProfile
+
+	return md, nil
+}
+
+// workspacesProfile describes the workspaces and organizations the principal
+// belongs to. Those the principal is a guest of are not synced.
+func workspacesProfile(workspaceMemberships []asana.WorkspaceMembership) []interface{} {
+	rv := make([]interface{}, 0, len(workspaceMemberships))
+	for _, workspaceMembership := range workspaceMemberships {
+		rv = append(rv, map[string]interface{}{
+			"id":              workspaceMembership.Workspace.Gid,
+			"name":            workspaceMembership.Workspace.Name,
+			"is_organization": workspaceMembership.Workspace.IsOrganization,
+			"is_admin":        workspaceMembership.IsAdmin,
+			"in_scope":        !workspaceMembership.IsGuest,
+		})
+	}
+	return rv
+}
+
+// features describes which optional provisioning, sync and event features
+// are enabled, given the configuration and the detected capabilities.
+func (as *Asana) features() map[string]interface{} {
+	canManageMembers := as.capabilities.canProvision() == nil
+	dormantAfterDays := 0
+	if as.activity != nil {
+		dormantAfterDays = int(as.activity.dormantAfter / (24 * time.Hour))
+	}
+
+	return map[string]interface{}{
+		"provisioning": map[string]interface{}{
+			"workspace_members":          canManageMembers,
+			"team_members":               canManageMembers,
+			"team_join_request_approval": canManageMembers && as.capabilities.canReadJoinRequests(),
+			"project_owners":             as.resourceTypes.syncs(resourceTypeProject.Id),
+			"offboarding":                as.offboarder != nil,
+		},
+		"sync": map[string]interface{}{
+			"guest_access_report": as.guests.flagsGuests() && as.capabilities.canReadMemberships(),
+			"dormant_after_days":  dormantAfterDays,
+			"organization_export": as.export != nil,
+			"sensitive_projects":  len(as.sensitiveProjects),
+			"scim_profiles":       as.capabilities.canUseScim(),
+		},
+		// Webhooks are received by the webhook command rather than during
+		// syncs, so they are not reported here.
+		"events": map[string]interface{}{
+			"audit_log": as.capabilities.hasAuditLog(),
+		},
+	}
 }
 
-// Validate hits the Asana API to validate that the API key passed has admin rights.
+// Validate hits the Asana API to validate that the API key passed has admin
+// rights and detects which capabilities the credentials have.
 func (as *Asana) Validate(ctx context.Context) (annotations.Annotations, error) {
-	workspaceMemberships, err := as.client.AuthCheck(ctx)
+	id, err := as.authenticate(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("baton-asana: failed to authenticate. Error: %w", err)
 	}
 
-	for _, workspaceMembership := range workspaceMemberships {
+	for _, workspaceMembership := range id.workspaceMemberships {
 		if !workspaceMembership.IsGuest {
 			allowedWorkspaces = append(allowedWorkspaces, workspaceMembership.Workspace.Gid)
 		}
 	}
+
 	return nil, nil
 }
 
+// Config holds the options the Asana connector is created with.
+type Config struct {
+	// AccessToken is a personal access token. It is ignored when an OAuth
+	// refresh token is configured.
+	AccessToken       string
+	OAuthClientID     string
+	OAuthClientSecret string
+	OAuthRefreshToken string
+	// TeamMembershipPrefetchWorkers enables concurrently fetching all
+	// memberships of listed teams with up to this many workers.
+	TeamMembershipPrefetchWorkers int
+	// Offboarding enables handing over what a user owns before removing
+	// them from a workspace.
+	Offboarding bool
+	// OffboardingSuccessor is the gid or email of the user taking over from
+	// offboarded users. When empty the manager of each user takes over.
+	OffboardingSuccessor string
+	// GuestAccessReport enables flagging the grants of teams, projects and
+	// portfolios to guests.
+	GuestAccessReport bool
+	// DormantAfterDays flags workspace members who have not logged in for
+	// this many days as dormant. Zero disables dormancy detection.
+	DormantAfterDays int
+	// SensitiveProjects lists the gids of the projects whose tasks followed
+	// by users outside the project are synced.
+	SensitiveProjects []string
+	// SensitiveTaskPageLimit bounds the pages of tasks scanned per sensitive
+	// project.
+	SensitiveTaskPageLimit int
+	// OrganizationExport enables reading users, teams and memberships of
+	// organizations from organization exports instead of paginating.
+	OrganizationExport bool
+	// Record is the path of a cassette every request to Asana and its
+	// response are recorded to.
+	Record string
+	// Replay is the path of a cassette responses are served from instead of
+	// Asana, without any network access.
+	Replay string
+	// RedactFields lists the JSON and form fields whose values are redacted
+	// from cassettes, on top of credentials.
+	RedactFields []string
+	// ResourceTypes lists the ids of the resource types to sync. When empty
+	// every resource type is synced.
+	ResourceTypes []string
+	// SkipGrants lists the ids of the resource types synced without their
+	// entitlements and grants.
+	SkipGrants []string
+}
+
+// newHttpClient returns an HTTP client authenticating either through the
+// OAuth app, refreshing access tokens as they expire, or through the
+// personal access token added by the Asana client to each request.
+func newHttpClient(ctx context.Context, config Config) (*http.Client, error) {
+	if config.OAuthRefreshToken == "" {
+		return uhttp.NewClient(ctx, uhttp.WithLogger(true, ctxzap.Extract(ctx)))
+	}
+
+	// Without an initial access token the first request exchanges the
+	// refresh token, after which tokens are refreshed once expired.
+	credentials := uhttp.NewOAuth2RefreshToken(
+		config.OAuthClientID,
+		config.OAuthClientSecret,
+		"",
+		asana.OAuthTokenUrl,
+		"",
+		config.OAuthRefreshToken,
+		nil,
+	)
+
+	return credentials.GetClient(ctx)
+}
+
+// NewClient returns an Asana API client authenticated as configured. It
+// records its requests to a cassette or replays them from one when set. When
+// recording, the returned closer syncs and closes the cassette and must be
+// closed once the client is no longer used; it is nil otherwise.
+func NewClient(ctx context.Context, config Config) (*asana.Client, io.Closer, error) {
+	var httpClient, downloadClient *http.Client
+	var closer io.Closer
+	switch {
+	case config.Replay != "":
+		replayer, err := cassette.LoadReplayer(config.Replay, config.RedactFields)
+		if err != nil {
+			return nil, nil, fmt.Errorf("baton-asana: failed to load cassette: %w", err)
+		}
+		httpClient = &http.Client{Transport: replayer}
+		downloadClient = httpClient
+	default:
+		var err error
+		httpClient, err = newHttpClient(ctx, config)
+		if err != nil {
+			return nil, nil, err
+		}
+		downloadClient = http.DefaultClient
+
+		if config.Record != "" {
+			// Every interaction is written as soon as it completes. The
+			// cassette is only readable by its owner since it may still hold
+			// personal data outside the redacted fields.
+			f, err := os.OpenFile(config.Record, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+			if err != nil {
+				return nil, nil, fmt.Errorf("baton-asana: failed to create cassette: %w", err)
+			}
+			recorder := cassette.NewRecorder(f, config.RedactFields)
+			httpClient.Transport = recorder.Transport(httpClient.Transport)
+			downloadClient = &http.Client{Transport: recorder.Transport(http.DefaultTransport)}
+			closer = recorder
+		}
+	}
+
+	accessToken := config.AccessToken
+	if config.OAuthRefreshToken != "" {
+		accessToken = ""
+	}
+
+	uhttpClient, err := uhttp.NewBaseHttpClientWithContext(ctx, httpClient)
+	if err != nil {
+		if closer != nil {
+			_ = closer.Close()
+		}
+		return nil, nil, err
+	}
+
+	client := asana.NewClient(accessToken, uhttpClient)
+	client.SetDownloadClient(downloadClient)
+
+	return client, closer, nil
+}
+
+// Close closes the cassette requests are recorded to, if any.
+func (as *Asana) Close() error {
+	if as.cassette == nil {
+		return nil
+	}
+	return as.cassette.Close()
+}
+
 // New returns the Asana connector.
-func New(ctx context.Context, accessToken string) (*Asana, error) {
-	httpClient, err := uhttp.NewClient(ctx, uhttp.WithLogger(true, ctxzap.Extract(ctx)))
+func New(ctx context.Context, config Config) (*Asana, error) {
+	resourceTypes, err := newResourceTypeSelection(config.ResourceTypes, config.SkipGrants)
 	if err != nil {
 		return nil, err
 	}
 
-	uhttpClient, err := uhttp.NewBaseHttpClientWithContext(ctx, httpClient)
+	client, closer, err := NewClient(ctx, config)
 	if err != nil {
 		return nil, err
 	}
 
+	var export *orgExportSource
+	if config.OrganizationExport {
+		export = newOrgExportSource(client)
+	}
+
+	caps := &capabilities{}
+
+	var ob *offboarder
+	if config.Offboarding {
+		ob = newOffboarder(client, caps, config.OffboardingSuccessor)
+	}
+
 	return &Asana{
-		client:            asana.NewClient(accessToken, uhttpClient),
+		client:            client,
 		allowedWorkspaces: &allowedWorkspaces,
+		capabilities:      caps,
+		prefetchWorkers:   config.TeamMembershipPrefetchWorkers,
+		offboarder:        ob,
+		guests:            newGuestDirectory(client, caps, config.GuestAccessReport),
+		sensitiveProjects: config.SensitiveProjects,
+		taskPageLimit:     config.SensitiveTaskPageLimit,
+		export:            export,
+		scim:              newScimDirectory(client, caps),
+		activity:          newActivityDirectory(client, caps, config.DormantAfterDays),
+		resourceTypes:     resourceTypes,
+		cassette:          closer,
 	}, nil
 }
@@ -0,0 +1,198 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/conductorone/baton-asana/pkg/asana"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	ent "github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+)
+
+const (
+	customFieldAdmin  = "Admin"
+	customFieldEditor = "Editor"
+)
+
+var customFieldRoles = []string{
+	customFieldAdmin,
+	customFieldEditor,
+}
+
+// customFieldAccessLevels maps the access levels of custom field memberships
+// allowing to alter the field to entitlements.
+var customFieldAccessLevels = map[string]string{
+	"admin":  customFieldAdmin,
+	"editor": customFieldEditor,
+}
+
+type customFieldResourceType struct {
+	resourceType *v2.ResourceType
+	client       *asana.Client
+	capabilities *capabilities
+}
+
+func (o *customFieldResourceType) ResourceType(_ context.Context) *v2.ResourceType {
+	return o.resourceType
+}
+
+// Create a new connector resource for an Asana custom field.
+func customFieldResource(customField *asana.CustomField, parentResourceID *v2.ResourceId) (*v2.Resource, error) {
+	scope := "local"
+	if customField.IsGlobalToWorkspace {
+		scope = "global to workspace"
+	}
+	details := []string{
+		fmt.Sprintf("type: %s", customField.ResourceSubtype),
+		fmt.Sprintf("scope: %s", scope),
+	}
+	if customField.PrivacySetting != "" {
+		details = append(details, fmt.Sprintf("privacy: %s", customField.PrivacySetting))
+	}
+	if customField.CreatedBy != nil {
+		details = append(details, fmt.Sprintf("created by: %s", customField.CreatedBy.Name))
+	}
+
+	description := strings.Join(details, ", ")
+	if customField.Description != "" {
+		description = fmt.Sprintf("%s (%s)", customField.Description, description)
+	}
+
+	return rs.NewResource(
+		customField.Name,
+		resourceTypeCustomField,
+		customField.Gid,
+		rs.WithParentResourceID(parentResourceID),
+		rs.WithDescription(description),
+	)
+}
+
+func (o *customFieldResourceType) List(ctx context.Context, parentId *v2.ResourceId, token *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	if parentId == nil {
+		return nil, "", nil, nil
+	}
+
+	bag, err := parsePageToken(token.Token, &v2.ResourceId{ResourceType: resourceTypeCustomField.Id})
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	customFields, nextToken, _, err := o.client.GetCustomFields(ctx, asana.GetCustomFieldsVars{WorkspaceId: parentId.Resource, Limit: ResourcesPageSize, Offset: bag.PageToken()})
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("baton-asana: failed to list custom fields: %w", err)
+	}
+
+	pageToken, err := bag.NextToken(nextToken)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	var rv []*v2.Resource
+	for _, customField := range customFields {
+		customFieldCopy := customField
+		cr, err := customFieldResource(&customFieldCopy, parentId)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		rv = append(rv, cr)
+	}
+
+	return rv, pageToken, nil, nil
+}
+
+func (o *customFieldResourceType) Entitlements(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	var rv []*v2.Entitlement
+	for _, role := range customFieldRoles {
+		permissionOptions := []ent.EntitlementOption{
+			ent.WithGrantableTo(resourceTypeUser, resourceTypeTeam),
+			ent.WithDescription(fmt.Sprintf("Can edit the %s Asana custom field", resource.DisplayName)),
+			ent.WithDisplayName(fmt.Sprintf("%s Custom Field %s", resource.DisplayName, role)),
+		}
+
+		permissionEn := ent.NewPermissionEntitlement(resource, role, permissionOptions...)
+		rv = append(rv, permissionEn)
+	}
+	return rv, "", nil, nil
+}
+
+func (o *customFieldResourceType) Grants(ctx context.Context, resource *v2.Resource, token *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	var workspaceId string
+	if resource.ParentResourceId != nil {
+		workspaceId = resource.ParentResourceId.Resource
+	}
+	if !o.capabilities.canReadCustomFieldMemberships(workspaceId) {
+		return nil, "", nil, nil
+	}
+
+	bag, err := parsePageToken(token.Token, resource.Id)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	memberships, offset, resp, err := o.client.GetMemberships(ctx, asana.GetMembershipsVars{ParentId: resource.Id.Resource, Limit: ResourcesPageSize, Offset: bag.PageToken()})
+	if err != nil {
+		// Memberships are only available on plans supporting them, so their
+		// editors are unknown on other plans. This is logged once and the
+		// other custom fields of the workspace are skipped without a request.
+		if resp != nil && resp.StatusCode == http.StatusPaymentRequired {
+			if o.capabilities.disableCustomFieldMemberships(workspaceId) {
+				ctxzap.Extract(ctx).Warn(
+					"baton-asana: skipping custom field editors, the plan of the workspace does not support custom field memberships",
+					zap.String("workspace_id", workspaceId),
+				)
+			}
+			return nil, "", nil, nil
+		}
+		// Memberships are also unavailable for custom fields without
+		// restricted edit access, but that cannot be told apart from missing
+		// permissions, so the field is skipped visibly.
+		if isUnavailable(resp) {
+			ctxzap.Extract(ctx).Warn(
+				"baton-asana: skipping custom field editors, memberships are unavailable",
+				zap.String("custom_field_id", resource.Id.Resource),
+				zap.Int("status", resp.StatusCode),
+				zap.Error(err),
+			)
+			return nil, "", nil, nil
+		}
+		return nil, "", nil, fmt.Errorf("baton-asana: failed to list custom field memberships: %w", err)
+	}
+
+	pageToken, err := bag.NextToken(offset)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	var rv []*v2.Grant
+	for _, membership := range memberships {
+		roleName, ok := customFieldAccessLevels[membership.AccessLevel]
+		if !ok {
+			continue
+		}
+
+		permissionGrant, err := membershipGrant(resource, roleName, membership.Member)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		if permissionGrant != nil {
+			rv = append(rv, permissionGrant)
+		}
+	}
+
+	return rv, pageToken, nil, nil
+}
+
+func customFieldBuilder(client *asana.Client, capabilities *capabilities) *customFieldResourceType {
+	return &customFieldResourceType{
+		resourceType: resourceTypeCustomField,
+		client:       client,
+		capabilities: capabilities,
+	}
+}
@@ -0,0 +1,138 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/conductorone/baton-asana/pkg/asana"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const (
+	deprovisionRemoveFromTeam      = "remove_from_team"
+	deprovisionRemoveFromWorkspace = "remove_from_workspace"
+
+	deprovisionSucceeded = "succeeded"
+	// deprovisionSkipped is recorded for removals of memberships already
+	// gone, e.g. when retrying after a partial failure.
+	deprovisionSkipped = "skipped"
+	deprovisionFailed  = "failed"
+)
+
+// deprovisionStep records the outcome of a single removal.
+type deprovisionStep struct {
+	Action       string
+	ResourceId   string
+	ResourceName string
+	Status       string
+	Error        string
+}
+
+// deprovisioningReport records the removals made while deprovisioning a user,
+// up to and including the first one that failed.
+type deprovisioningReport struct {
+	UserId string
+	Steps  []deprovisionStep
+	// AlreadyRemoved is set when the user was not a member of the workspace.
+	AlreadyRemoved bool
+}
+
+// deprovision removes a user from every team they are a member of in a
+// workspace, one team at a time, and then from the workspace. Removing the
+// user from their teams first leaves each team in a known state when a later
+// removal fails, e.g. because the user is the last admin of a team. It stops
+// at the first failure; teams the user was removed from are no longer listed,
+// and removals of memberships already gone are skipped, so deprovisioning can
+// safely be retried. Only organizations have teams, so users are removed from
+// plain workspaces directly.
+func deprovision(ctx context.Context, client *asana.Client, workspaceId, userId string) (*deprovisioningReport, error) {
+	l := ctxzap.Extract(ctx)
+
+	report := &deprovisioningReport{UserId: userId}
+
+	workspace, _, err := client.GetWorkspace(ctx, workspaceId)
+	if err != nil {
+		return report, fmt.Errorf("baton-asana: failed to get workspace %s: %w", workspaceId, err)
+	}
+
+	// Teams drop out of the listing as the user is removed, so they are
+	// collected before removing the user from any of them.
+	var teams []asana.Team
+	if workspace.IsOrganization {
+		for team, err := range client.AllUserTeams(ctx, userId, workspaceId) {
+			if err != nil {
+				return report, fmt.Errorf("baton-asana: failed to list the teams of user %s: %w", userId, err)
+			}
+			teams = append(teams, team)
+		}
+	}
+
+	for _, team := range teams {
+		err := client.RemoveUserToTeam(ctx, team.Gid, userId)
+		report.record(deprovisionRemoveFromTeam, team.Gid, team.Name, err)
+		if err != nil && !errors.Is(err, asana.ErrNotMember) {
+			return report, fmt.Errorf("baton-asana: failed to remove user %s from team %s: %w", userId, team.Gid, err)
+		}
+	}
+
+	err = client.RemoveUserToWorkspace(ctx, workspaceId, userId)
+	report.record(deprovisionRemoveFromWorkspace, workspaceId, "", err)
+	if errors.Is(err, asana.ErrNotMember) {
+		report.AlreadyRemoved = true
+	} else if err != nil {
+		return report, err
+	}
+
+	l.Info(
+		"baton-asana: deprovisioned user",
+		zap.String("user_id", userId),
+		zap.String("workspace_id", workspaceId),
+		zap.Int("teams", len(teams)),
+	)
+
+	return report, nil
+}
+
+func (r *deprovisioningReport) record(action, resourceId, resourceName string, err error) {
+	step := deprovisionStep{
+		Action:       action,
+		ResourceId:   resourceId,
+		ResourceName: resourceName,
+		Status:       deprovisionSucceeded,
+	}
+	switch {
+	case errors.Is(err, asana.ErrNotMember):
+		step.Status = deprovisionSkipped
+	case err != nil:
+		step.Status = deprovisionFailed
+		step.Error = err.Error()
+	}
+	r.Steps = append(r.Steps, step)
+}
+
+// annotation returns the report as a revoke annotation.
+func (r *deprovisioningReport) annotation() (*structpb.Struct, error) {
+	steps := make([]interface{}, 0, len(r.Steps))
+	for _, step := range r.Steps {
+		s := map[string]interface{}{
+			"action":        step.Action,
+			"resource_id":   step.ResourceId,
+			"resource_name": step.ResourceName,
+			"status":        step.Status,
+		}
+		if step.Error != "" {
+			s["error"] = step.Error
+		}
+		steps = append(steps, s)
+	}
+
+	return structpb.NewStruct(map[string]interface{}{
+		"deprovisioning": map[string]interface{}{
+			"user_id": r.UserId,
+			"steps":   steps,
+		},
+	})
+}
@@ -0,0 +1,144 @@
+package connector
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/conductorone/baton-asana/pkg/asana"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	grant "github.com/conductorone/baton-sdk/pkg/types/grant"
+)
+
+// auditLogUserInvited is the audit log event recorded when a user is invited
+// to a workspace, with the inviting user as actor.
+const auditLogUserInvited = "user_invited"
+
+// guestDirectory collects, per workspace, who invited each user and which
+// users are guests. Inviters are loaded lazily the first time users of a
+// workspace are listed, and guests are recorded from the workspace
+// memberships synced with users, so that the grants of teams, projects and
+// portfolios to guests can be flagged without crawling them a second time.
+type guestDirectory struct {
+	client       *asana.Client
+	capabilities *capabilities
+	// accessReport enables flagging the grants of teams, projects and
+	// portfolios to guests.
+	accessReport bool
+
+	mu         sync.Mutex
+	workspaces map[string]*workspaceGuests
+}
+
+// workspaceGuests holds what is known about the users of a single workspace.
+type workspaceGuests struct {
+	inviters map[string]asana.AuditLogActor
+	guests   map[string]bool
+}
+
+func newGuestDirectory(client *asana.Client, caps *capabilities, accessReport bool) *guestDirectory {
+	return &guestDirectory{
+		client:       client,
+		capabilities: caps,
+		accessReport: accessReport,
+		workspaces:   make(map[string]*workspaceGuests),
+	}
+}
+
+// workspace returns the guest details of a workspace, loading its inviters on
+// first use.
+func (d *guestDirectory) workspace(ctx context.Context, workspaceId string) (*workspaceGuests, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if wg, ok := d.workspaces[workspaceId]; ok {
+		return wg, nil
+	}
+
+	wg := &workspaceGuests{
+		inviters: make(map[string]asana.AuditLogActor),
+		guests:   make(map[string]bool),
+	}
+
+	if d.capabilities.hasAuditLog() {
+		if err := d.loadInviters(ctx, workspaceId, wg); err != nil {
+			return nil, err
+		}
+	}
+
+	d.workspaces[workspaceId] = wg
+
+	return wg, nil
+}
+
+// flagsGuests reports whether the grants of guests are flagged.
+func (d *guestDirectory) flagsGuests() bool {
+	return d != nil && d.accessReport
+}
+
+// recordGuests records the guests among synced workspace memberships.
+func (d *guestDirectory) recordGuests(workspaceId string, workspaceMemberships []asana.WorkspaceMembership) {
+	if d == nil || !d.accessReport {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	wg, ok := d.workspaces[workspaceId]
+	if !ok {
+		return
+	}
+	for _, workspaceMembership := range workspaceMemberships {
+		if workspaceMembership.IsGuest {
+			wg.guests[workspaceMembership.User.Gid] = true
+		}
+	}
+}
+
+// grantOptions returns the options flagging a grant to a principal of a
+// workspace as guest access, when the guest access report is enabled and the
+// principal was synced as a guest of the workspace.
+func (d *guestDirectory) grantOptions(workspaceId *v2.ResourceId, principalId string) []grant.GrantOption {
+	if d == nil || !d.accessReport || workspaceId == nil {
+		return nil
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	wg, ok := d.workspaces[workspaceId.Resource]
+	if !ok || !wg.guests[principalId] {
+		return nil
+	}
+
+	return []grant.GrantOption{grant.WithGrantMetadata(map[string]interface{}{"guest": true})}
+}
+
+// loadInviters records the latest inviter of each user found in the audit log.
+func (d *guestDirectory) loadInviters(ctx context.Context, workspaceId string, wg *workspaceGuests) error {
+	for event, err := range d.client.AllAuditLogEvents(ctx, workspaceId, auditLogUserInvited, time.Time{}) {
+		if err != nil {
+			return err
+		}
+		if event.Resource.Gid == "" || event.Actor.Gid == "" {
+			continue
+		}
+		wg.inviters[event.Resource.Gid] = event.Actor
+	}
+
+	return nil
+}
+
+// profile returns the inviter of a user as user profile fields.
+func (wg *workspaceGuests) profile(userId string) map[string]interface{} {
+	profile := make(map[string]interface{})
+
+	if inviter, ok := wg.inviters[userId]; ok {
+		profile["inviter_id"] = inviter.Gid
+		profile["inviter_name"] = inviter.Name
+		profile["inviter_email"] = inviter.Email
+	}
+
+	return profile
+}
@@ -1,8 +1,13 @@
 package connector
 
 import (
+	"net/http"
+
+	"github.com/conductorone/baton-asana/pkg/asana"
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
 	"github.com/conductorone/baton-sdk/pkg/pagination"
+	grant "github.com/conductorone/baton-sdk/pkg/types/grant"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
 )
 
 var ResourcesPageSize = 50
@@ -23,3 +28,44 @@ func parsePageToken(i string, resourceID *v2.ResourceId) (*pagination.Bag, error
 
 	return b, nil
 }
+
+// isUnavailable reports whether a failed request was rejected by Asana
+// because the endpoint is not available for the resource or the credentials.
+func isUnavailable(resp *http.Response) bool {
+	if resp == nil {
+		return false
+	}
+
+	switch resp.StatusCode {
+	case http.StatusBadRequest, http.StatusPaymentRequired, http.StatusForbidden, http.StatusNotFound:
+		return true
+	default:
+		return false
+	}
+}
+
+// membershipGrant returns the grant of an entitlement to the member of an
+// Asana membership. Teams are granted the entitlement as a whole and the
+// grant is expanded to everyone holding a role in the team. Members of any
+// other type are skipped by returning nil.
+func membershipGrant(resource *v2.Resource, entitlementName string, member asana.BaseResource, grantOptions ...grant.GrantOption) (*v2.Grant, error) {
+	switch member.ResourceType {
+	case resourceTypeUser.Id:
+		principal, err := rs.NewResourceID(resourceTypeUser, member.Gid)
+		if err != nil {
+			return nil, err
+		}
+		return grant.NewGrant(resource, entitlementName, principal, grantOptions...), nil
+	case resourceTypeTeam.Id:
+		principal, err := rs.NewResourceID(resourceTypeTeam, member.Gid)
+		if err != nil {
+			return nil, err
+		}
+		grantOptions = append(grantOptions, grant.WithAnnotation(&v2.GrantExpandable{
+			EntitlementIds: teamMembershipEntitlementIds(principal),
+		}))
+		return grant.NewGrant(resource, entitlementName, principal, grantOptions...), nil
+	default:
+		return nil, nil
+	}
+}
@@ -0,0 +1,209 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/conductorone/baton-asana/pkg/asana"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// offboardingScanLimit bounds the projects and goals scanned for those owned
+// by an offboarded user, since Asana cannot list them by owner and every
+// revoke would otherwise scan the whole workspace.
+const offboardingScanLimit = 5000
+
+// offboarder hands over what a user owns in a workspace to a successor
+// before the user is removed from the workspace.
+type offboarder struct {
+	client       *asana.Client
+	capabilities *capabilities
+	// successor is the gid or email of the user receiving everything owned
+	// by offboarded users. When empty the manager of each user is used.
+	successor string
+}
+
+// offboardingReport records what was handed over to the successor.
+type offboardingReport struct {
+	SuccessorId string
+	Projects    []string
+	// SharedPortfolios lists the portfolios the successor was added to as a
+	// member. Their owner is unchanged.
+	SharedPortfolios []string
+	Goals            []string
+	Tasks            []string
+	// Skipped describes what could not be handed over, and why.
+	Skipped []string
+}
+
+func newOffboarder(client *asana.Client, caps *capabilities, successor string) *offboarder {
+	return &offboarder{
+		client:       client,
+		capabilities: caps,
+		successor:    successor,
+	}
+}
+
+// resolveSuccessor returns the gid of the user taking over from userId.
+func (o *offboarder) resolveSuccessor(ctx context.Context, userId string) (string, error) {
+	successor := o.successor
+	if successor == "" {
+		scimUser, err := o.client.GetScimUser(ctx, userId)
+		if err != nil {
+			return "", fmt.Errorf("baton-asana: failed to look up the manager of user %s: %w", userId, err)
+		}
+		if scimUser.Enterprise == nil || scimUser.Enterprise.Manager == nil || scimUser.Enterprise.Manager.Value == "" {
+			return "", fmt.Errorf("baton-asana: user %s has no manager to hand over to and no successor is configured", userId)
+		}
+		successor = scimUser.Enterprise.Manager.Value
+	}
+
+	user, err := o.client.GetUser(ctx, successor)
+	if err != nil {
+		return "", fmt.Errorf("baton-asana: failed to look up successor %s: %w", successor, err)
+	}
+
+	if user.Gid == userId {
+		return "", fmt.Errorf("baton-asana: user %s cannot be their own successor", userId)
+	}
+
+	return user.Gid, nil
+}
+
+// offboard transfers the projects, goals and incomplete tasks a user owns in
+// a workspace to the successor and adds the successor to the portfolios the
+// user owns, since Asana does not allow changing portfolio owners. Only
+// service accounts can list the portfolios of other users, so portfolios are
+// skipped otherwise, as are the projects and goals beyond the first
+// offboardingScanLimit of the workspace. It stops at the first failure;
+// transferred items are no longer owned by the user so offboarding can safely
+// be retried.
+func (o *offboarder) offboard(ctx context.Context, workspaceId, userId string) (*offboardingReport, error) {
+	l := ctxzap.Extract(ctx)
+
+	successorId, err := o.resolveSuccessor(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &offboardingReport{SuccessorId: successorId}
+
+	l.Info(
+		"baton-asana: scanning workspace projects and goals for those owned by the offboarded user",
+		zap.String("user_id", userId),
+		zap.String("workspace_id", workspaceId),
+		zap.Int("scan_limit", offboardingScanLimit),
+	)
+
+	scanned := 0
+	for project, err := range o.client.AllProjects(ctx, workspaceId) {
+		if err != nil {
+			return report, err
+		}
+		if scanned++; scanned > offboardingScanLimit {
+			report.skip(ctx, fmt.Sprintf("projects: only the first %d projects of the workspace were scanned, projects owned by the user beyond them were not transferred", offboardingScanLimit))
+			break
+		}
+		if project.Owner == nil || project.Owner.Gid != userId {
+			continue
+		}
+		if err := o.client.SetProjectOwner(ctx, project.Gid, successorId); err != nil {
+			return report, fmt.Errorf("baton-asana: failed to transfer project %s: %w", project.Gid, err)
+		}
+		report.Projects = append(report.Projects, project.Gid)
+	}
+
+	if o.capabilities.isServiceAccount() {
+		for portfolio, err := range o.client.AllPortfolios(ctx, workspaceId, userId) {
+			if err != nil {
+				return report, err
+			}
+			if err := o.client.AddPortfolioMember(ctx, portfolio.Gid, successorId); err != nil {
+				return report, fmt.Errorf("baton-asana: failed to share portfolio %s: %w", portfolio.Gid, err)
+			}
+			report.SharedPortfolios = append(report.SharedPortfolios, portfolio.Gid)
+		}
+		if len(report.SharedPortfolios) > 0 {
+			report.skip(ctx, fmt.Sprintf("portfolios: Asana does not allow changing portfolio owners, the successor was added as a member of %d portfolios still owned by the user", len(report.SharedPortfolios)))
+		}
+	} else {
+		report.skip(ctx, "portfolios: only service accounts can list the portfolios of other users")
+	}
+
+	scanned = 0
+	for goal, err := range o.client.AllGoals(ctx, workspaceId) {
+		if err != nil {
+			return report, err
+		}
+		if scanned++; scanned > offboardingScanLimit {
+			report.skip(ctx, fmt.Sprintf("goals: only the first %d goals of the workspace were scanned, goals owned by the user beyond them were not transferred", offboardingScanLimit))
+			break
+		}
+		if goal.Owner == nil || goal.Owner.Gid != userId {
+			continue
+		}
+		if err := o.client.SetGoalOwner(ctx, goal.Gid, successorId); err != nil {
+			return report, fmt.Errorf("baton-asana: failed to transfer goal %s: %w", goal.Gid, err)
+		}
+		report.Goals = append(report.Goals, goal.Gid)
+	}
+
+	// Reassigned tasks drop out of the listing, so they are collected before
+	// reassigning any of them.
+	var taskIds []string
+	for task, err := range o.client.AllIncompleteTasks(ctx, workspaceId, userId) {
+		if err != nil {
+			return report, err
+		}
+		taskIds = append(taskIds, task.Gid)
+	}
+	for _, taskId := range taskIds {
+		if err := o.client.SetTaskAssignee(ctx, taskId, successorId); err != nil {
+			return report, fmt.Errorf("baton-asana: failed to reassign task %s: %w", taskId, err)
+		}
+		report.Tasks = append(report.Tasks, taskId)
+	}
+
+	l.Info(
+		"baton-asana: offboarded user",
+		zap.String("user_id", userId),
+		zap.String("successor_id", successorId),
+		zap.Int("projects", len(report.Projects)),
+		zap.Int("shared_portfolios", len(report.SharedPortfolios)),
+		zap.Int("goals", len(report.Goals)),
+		zap.Int("tasks", len(report.Tasks)),
+		zap.Strings("skipped", report.Skipped),
+	)
+
+	return report, nil
+}
+
+// skip records and logs something that could not be handed over.
+func (r *offboardingReport) skip(ctx context.Context, reason string) {
+	ctxzap.Extract(ctx).Warn("baton-asana: offboarding incomplete", zap.String("successor_id", r.SuccessorId), zap.String("reason", reason))
+	r.Skipped = append(r.Skipped, reason)
+}
+
+// annotation returns the report as a revoke annotation.
+func (r *offboardingReport) annotation() (*structpb.Struct, error) {
+	return structpb.NewStruct(map[string]interface{}{
+		"offboarding": map[string]interface{}{
+			"successor_id":      r.SuccessorId,
+			"projects":          toInterfaceSlice(r.Projects),
+			"shared_portfolios": toInterfaceSlice(r.SharedPortfolios),
+			"goals":             toInterfaceSlice(r.Goals),
+			"tasks":             toInterfaceSlice(r.Tasks),
+			"skipped":           toInterfaceSlice(r.Skipped),
+		},
+	})
+}
+
+func toInterfaceSlice(values []string) []interface{} {
+	rv := make([]interface{}, 0, len(values))
+	for _, v := range values {
+		rv = append(rv, v)
+	}
+	return rv
+}
@@ -0,0 +1,142 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/conductorone/baton-asana/pkg/asana"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+)
+
+// orgExportPollInterval is how often a running organization export is polled.
+const orgExportPollInterval = 10 * time.Second
+
+// orgExportSource serves users, teams and memberships of organizations from
+// organization exports instead of paginating through them. Each organization
+// is exported once, the first time it is synced. Exports are parsed while
+// they are downloaded, and only their users, teams and memberships are kept
+// in memory to serve pages from for the rest of the sync.
+//
+// Exports do not include the visibility of teams, so pending requests to
+// join teams are not synced from them.
+type orgExportSource struct {
+	client *asana.Client
+
+	mu      sync.Mutex
+	exports map[string]*orgExport
+}
+
+// orgExport is the export of a single organization, which is done once it
+// is loaded or failed to load.
+type orgExport struct {
+	done chan struct{}
+	data *asana.OrganizationExportData
+	err  error
+}
+
+func newOrgExportSource(client *asana.Client) *orgExportSource {
+	return &orgExportSource{
+		client:  client,
+		exports: make(map[string]*orgExport),
+	}
+}
+
+// load returns the export of a workspace, running it on first use. It returns
+// nil when the workspace cannot be exported, e.g. when it is not an
+// organization or the credentials are not an Enterprise service account, in
+// which case callers paginate through the API instead. Concurrent callers
+// wait for the same export, without holding the lock while it runs, and a
+// failed export is run again by the next caller.
+func (s *orgExportSource) load(ctx context.Context, workspaceId string) (*asana.OrganizationExportData, error) {
+	if s == nil {
+		return nil, nil
+	}
+
+	s.mu.Lock()
+	export, running := s.exports[workspaceId]
+	if !running {
+		export = &orgExport{done: make(chan struct{})}
+		s.exports[workspaceId] = export
+	}
+	s.mu.Unlock()
+
+	if !running {
+		export.data, export.err = s.run(ctx, workspaceId)
+		if export.err != nil {
+			s.mu.Lock()
+			delete(s.exports, workspaceId)
+			s.mu.Unlock()
+		}
+		close(export.done)
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-export.done:
+		return export.data, export.err
+	}
+}
+
+// run exports a workspace, waits for the export to finish and downloads it.
+func (s *orgExportSource) run(ctx context.Context, workspaceId string) (*asana.OrganizationExportData, error) {
+	l := ctxzap.Extract(ctx)
+
+	export, resp, err := s.client.CreateOrganizationExport(ctx, workspaceId)
+	if err != nil {
+		if isUnavailable(resp) {
+			l.Warn("baton-asana: organization export unavailable, paginating instead", zap.String("workspace_id", workspaceId), zap.Error(err))
+			return nil, nil
+		}
+		return nil, fmt.Errorf("baton-asana: failed to export organization %s: %w", workspaceId, err)
+	}
+
+	l.Info("baton-asana: waiting for organization export", zap.String("workspace_id", workspaceId), zap.String("export_id", export.Gid))
+
+	export, err = s.client.WaitForOrganizationExport(ctx, export, orgExportPollInterval)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := s.client.DownloadOrganizationExport(ctx, export)
+	if err != nil {
+		return nil, err
+	}
+
+	l.Info(
+		"baton-asana: loaded organization export, pending team join requests are not synced from it",
+		zap.String("workspace_id", workspaceId),
+		zap.Int("users", len(data.Users)),
+		zap.Int("teams", len(data.Teams)),
+		zap.Int("workspace_memberships", len(data.WorkspaceMemberships)),
+	)
+
+	return data, nil
+}
+
+// pageSlice returns the page of items starting at the index encoded in
+// offset, along with the offset of the next page.
+func pageSlice[T any](items []T, offset string, size int) ([]T, string, error) {
+	start := 0
+	if offset != "" {
+		var err error
+		start, err = strconv.Atoi(offset)
+		if err != nil || start < 0 {
+			return nil, "", fmt.Errorf("baton-asana: invalid page offset %q", offset)
+		}
+	}
+	if start >= len(items) {
+		return nil, "", nil
+	}
+
+	end := min(start+size, len(items))
+	if end == len(items) {
+		return items[start:end], "", nil
+	}
+
+	return items[start:end], strconv.Itoa(end), nil
+}
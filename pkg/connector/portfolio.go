@@ -0,0 +1,254 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/conductorone/baton-asana/pkg/asana"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	ent "github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	grant "github.com/conductorone/baton-sdk/pkg/types/grant"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+)
+
+const (
+	portfolioAdmin  = "Admin"
+	portfolioEditor = "Editor"
+	portfolioViewer = "Viewer"
+)
+
+var portfolioRoles = []string{
+	portfolioAdmin,
+	portfolioEditor,
+	portfolioViewer,
+}
+
+// portfolioAccessLevels maps the access levels of portfolio memberships to entitlements.
+var portfolioAccessLevels = map[string]string{
+	"admin":  portfolioAdmin,
+	"editor": portfolioEditor,
+	"viewer": portfolioViewer,
+}
+
+// portfolioItemsPageState is the page state of the second phase of portfolio
+// grants, which walks the items of the portfolio once its memberships are done.
+const portfolioItemsPageState = "portfolio_items"
+
+type portfolioResourceType struct {
+	resourceType *v2.ResourceType
+	client       *asana.Client
+	capabilities *capabilities
+	// guests flags the memberships of guests when the guest access report
+	// is enabled.
+	guests *guestDirectory
+}
+
+func (o *portfolioResourceType) ResourceType(_ context.Context) *v2.ResourceType {
+	return o.resourceType
+}
+
+// Create a new connector resource for an Asana portfolio.
+func portfolioResource(portfolio *asana.Portfolio, parentResourceID *v2.ResourceId) (*v2.Resource, error) {
+	profile := map[string]interface{}{
+		"portfolio_id":   portfolio.Gid,
+		"portfolio_name": portfolio.Name,
+		"public":         portfolio.Public,
+	}
+	if portfolio.Owner != nil {
+		profile["owner_id"] = portfolio.Owner.Gid
+		profile["owner_name"] = portfolio.Owner.Name
+	}
+
+	groupTraitOptions := []rs.GroupTraitOption{rs.WithGroupProfile(profile)}
+
+	ret, err := rs.NewGroupResource(
+		portfolio.Name,
+		resourceTypePortfolio,
+		portfolio.Gid,
+		groupTraitOptions,
+		rs.WithParentResourceID(parentResourceID),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+func (o *portfolioResourceType) List(ctx context.Context, parentId *v2.ResourceId, token *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	if parentId == nil {
+		return nil, "", nil, nil
+	}
+
+	bag, err := parsePageToken(token.Token, &v2.ResourceId{ResourceType: resourceTypePortfolio.Id})
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	// Only service accounts can list portfolios they do not own.
+	ownerId := "me"
+	if o.capabilities.isServiceAccount() {
+		ownerId = ""
+	}
+
+	portfolios, nextToken, _, err := o.client.GetPortfolios(ctx, asana.GetPortfoliosVars{
+		WorkspaceId: parentId.Resource,
+		OwnerId:     ownerId,
+		Limit:       ResourcesPageSize,
+		Offset:      bag.PageToken(),
+	})
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("baton-asana: failed to list portfolios: %w", err)
+	}
+
+	pageToken, err := bag.NextToken(nextToken)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	var rv []*v2.Resource
+	for _, portfolio := range portfolios {
+		portfolioCopy := portfolio
+		pr, err := portfolioResource(&portfolioCopy, parentId)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		rv = append(rv, pr)
+	}
+
+	return rv, pageToken, nil, nil
+}
+
+func (o *portfolioResourceType) Entitlements(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	var rv []*v2.Entitlement
+	for _, role := range portfolioRoles {
+		grantableTo := []*v2.ResourceType{resourceTypeUser, resourceTypeTeam}
+		if role == portfolioViewer {
+			grantableTo = append(grantableTo, resourceTypePortfolio)
+		}
+
+		permissionOptions := []ent.EntitlementOption{
+			ent.WithGrantableTo(grantableTo...),
+			ent.WithDescription(fmt.Sprintf("Role in %s Asana portfolio", resource.DisplayName)),
+			ent.WithDisplayName(fmt.Sprintf("%s Portfolio %s", resource.DisplayName, role)),
+		}
+
+		permissionEn := ent.NewPermissionEntitlement(resource, role, permissionOptions...)
+		rv = append(rv, permissionEn)
+	}
+	return rv, "", nil, nil
+}
+
+// Grants returns the portfolio memberships, followed by grants of the viewer
+// entitlement of every project and portfolio contained in the portfolio.
+// Those are granted to the portfolio and expanded to its members, since
+// members of a portfolio can view everything inside it.
+func (o *portfolioResourceType) Grants(ctx context.Context, resource *v2.Resource, token *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	bag, err := parsePageToken(token.Token, resource.Id)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	if bag.ResourceTypeID() == portfolioItemsPageState {
+		return o.itemGrants(ctx, resource, bag)
+	}
+
+	memberships, offset, _, err := o.client.GetMemberships(ctx, asana.GetMembershipsVars{ParentId: resource.Id.Resource, Limit: ResourcesPageSize, Offset: bag.PageToken()})
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	var rv []*v2.Grant
+	for _, membership := range memberships {
+		roleName, ok := portfolioAccessLevels[membership.AccessLevel]
+		if !ok {
+			continue
+		}
+
+		permissionGrant, err := membershipGrant(resource, roleName, membership.Member, o.guests.grantOptions(resource.ParentResourceId, membership.Member.Gid)...)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		if permissionGrant != nil {
+			rv = append(rv, permissionGrant)
+		}
+	}
+
+	if offset != "" {
+		pageToken, err := bag.NextToken(offset)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		return rv, pageToken, nil, nil
+	}
+
+	bag.Pop()
+	bag.Push(pagination.PageState{
+		ResourceTypeID: portfolioItemsPageState,
+		ResourceID:     resource.Id.Resource,
+	})
+	pageToken, err := bag.Marshal()
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	return rv, pageToken, nil, nil
+}
+
+func (o *portfolioResourceType) itemGrants(ctx context.Context, resource *v2.Resource, bag *pagination.Bag) ([]*v2.Grant, string, annotations.Annotations, error) {
+	items, offset, _, err := o.client.GetPortfolioItems(ctx, asana.GetPortfolioItemsVars{PortfolioId: resource.Id.Resource, Limit: ResourcesPageSize, Offset: bag.PageToken()})
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	pageToken, err := bag.NextToken(offset)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	expandable := &v2.GrantExpandable{EntitlementIds: portfolioEntitlementIds(resource)}
+
+	var rv []*v2.Grant
+	for _, item := range items {
+		var itemResourceType *v2.ResourceType
+		switch item.ResourceType {
+		case resourceTypeProject.Id:
+			itemResourceType = resourceTypeProject
+		case resourceTypePortfolio.Id:
+			itemResourceType = resourceTypePortfolio
+		default:
+			continue
+		}
+
+		itemId, err := rs.NewResourceID(itemResourceType, item.Gid)
+		if err != nil {
+			return nil, "", nil, err
+		}
+
+		// Project and portfolio viewer entitlements share the same name.
+		rv = append(rv, grant.NewGrant(&v2.Resource{Id: itemId}, projectViewer, resource.Id, grant.WithAnnotation(expandable, &v2.GrantImmutable{})))
+	}
+
+	return rv, pageToken, nil, nil
+}
+
+// portfolioEntitlementIds returns the ids of the entitlements of every
+// portfolio role, which together make up the members of the portfolio.
+func portfolioEntitlementIds(portfolio *v2.Resource) []string {
+	rv := make([]string, 0, len(portfolioRoles))
+	for _, role := range portfolioRoles {
+		rv = append(rv, ent.NewEntitlementID(portfolio, role))
+	}
+	return rv
+}
+
+func portfolioBuilder(client *asana.Client, capabilities *capabilities, guests *guestDirectory) *portfolioResourceType {
+	return &portfolioResourceType{
+		resourceType: resourceTypePortfolio,
+		client:       client,
+		capabilities: capabilities,
+		guests:       guests,
+	}
+}
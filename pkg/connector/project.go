@@ -0,0 +1,284 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/conductorone/baton-asana/pkg/asana"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	ent "github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	grant "github.com/conductorone/baton-sdk/pkg/types/grant"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+)
+
+const (
+	projectOwner     = "Owner"
+	projectAdmin     = "Admin"
+	projectEditor    = "Editor"
+	projectCommenter = "Commenter"
+	projectViewer    = "Viewer"
+)
+
+var projectRoles = []string{
+	projectAdmin,
+	projectEditor,
+	projectCommenter,
+	projectViewer,
+}
+
+// projectAccessLevels maps the access levels of project memberships to entitlements.
+var projectAccessLevels = map[string]string{
+	"admin":     projectAdmin,
+	"editor":    projectEditor,
+	"commenter": projectCommenter,
+	"viewer":    projectViewer,
+}
+
+type projectResourceType struct {
+	resourceType *v2.ResourceType
+	client       *asana.Client
+	// sensitiveProjects lists the gids of the projects whose tasks are synced.
+	sensitiveProjects []string
+	// guests flags the memberships of guests when the guest access report
+	// is enabled.
+	guests *guestDirectory
+}
+
+func (o *projectResourceType) ResourceType(_ context.Context) *v2.ResourceType {
+	return o.resourceType
+}
+
+// Create a new connector resource for an Asana project.
+func projectResource(project *asana.Project, parentResourceID *v2.ResourceId, opts ...rs.ResourceOption) (*v2.Resource, error) {
+	profile := map[string]interface{}{
+		"project_id":      project.Gid,
+		"project_name":    project.Name,
+		"archived":        project.Archived,
+		"privacy_setting": project.PrivacySetting,
+	}
+	if project.Team != nil {
+		profile["team_id"] = project.Team.Gid
+		profile["team_name"] = project.Team.Name
+	}
+	if project.Owner != nil {
+		profile["owner_id"] = project.Owner.Gid
+		profile["owner_name"] = project.Owner.Name
+	}
+
+	groupTraitOptions := []rs.GroupTraitOption{rs.WithGroupProfile(profile)}
+
+	opts = append(opts, rs.WithParentResourceID(parentResourceID))
+
+	ret, err := rs.NewGroupResource(
+		project.Name,
+		resourceTypeProject,
+		project.Gid,
+		groupTraitOptions,
+		opts...,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+func (o *projectResourceType) List(ctx context.Context, parentId *v2.ResourceId, token *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	if parentId == nil {
+		return nil, "", nil, nil
+	}
+
+	bag, err := parsePageToken(token.Token, &v2.ResourceId{ResourceType: resourceTypeProject.Id})
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	projects, nextToken, _, err := o.client.GetProjects(ctx, asana.GetProjectsVars{WorkspaceId: parentId.Resource, Limit: ResourcesPageSize, Offset: bag.PageToken()})
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("baton-asana: failed to list projects: %w", err)
+	}
+
+	pageToken, err := bag.NextToken(nextToken)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	var rv []*v2.Resource
+	for _, project := range projects {
+		projectCopy := project
+		var opts []rs.ResourceOption
+		if slices.Contains(o.sensitiveProjects, project.Gid) {
+			opts = append(opts, rs.WithAnnotation(&v2.ChildResourceType{ResourceTypeId: resourceTypeTask.Id}))
+		}
+		pr, err := projectResource(&projectCopy, parentId, opts...)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		rv = append(rv, pr)
+	}
+
+	return rv, pageToken, nil, nil
+}
+
+func (o *projectResourceType) Entitlements(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	rv := []*v2.Entitlement{
+		ent.NewPermissionEntitlement(resource, projectOwner,
+			ent.WithGrantableTo(resourceTypeUser),
+			ent.WithDescription(fmt.Sprintf("Owner of %s Asana project", resource.DisplayName)),
+			ent.WithDisplayName(fmt.Sprintf("%s Project %s", resource.DisplayName, projectOwner)),
+		),
+	}
+	for _, role := range projectRoles {
+		grantableTo := []*v2.ResourceType{resourceTypeUser, resourceTypeTeam}
+		if role == projectViewer {
+			// Portfolios grant view access to the projects they contain.
+			grantableTo = append(grantableTo, resourceTypePortfolio)
+		}
+
+		// Project roles are synced but cannot be provisioned, only the owner
+		// can be changed.
+		permissionOptions := []ent.EntitlementOption{
+			ent.WithGrantableTo(grantableTo...),
+			ent.WithDescription(fmt.Sprintf("Role in %s Asana project", resource.DisplayName)),
+			ent.WithDisplayName(fmt.Sprintf("%s Project %s", resource.DisplayName, role)),
+			ent.WithAnnotation(&v2.EntitlementImmutable{}),
+		}
+
+		permissionEn := ent.NewPermissionEntitlement(resource, role, permissionOptions...)
+		rv = append(rv, permissionEn)
+	}
+	return rv, "", nil, nil
+}
+
+// Grants returns the project owner and memberships. Projects shared with a
+// team are granted to the team and expanded to its members.
+func (o *projectResourceType) Grants(ctx context.Context, resource *v2.Resource, token *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	bag, err := parsePageToken(token.Token, resource.Id)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	var rv []*v2.Grant
+	if bag.PageToken() == "" {
+		ownerGrant, err := projectOwnerGrant(resource)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		if ownerGrant != nil {
+			rv = append(rv, ownerGrant)
+		}
+	}
+
+	memberships, offset, _, err := o.client.GetMemberships(ctx, asana.GetMembershipsVars{ParentId: resource.Id.Resource, Limit: ResourcesPageSize, Offset: bag.PageToken()})
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	pageToken, err := bag.NextToken(offset)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	for _, membership := range memberships {
+		roleName, ok := projectAccessLevels[membership.AccessLevel]
+		if !ok {
+			continue
+		}
+
+		grantOptions := append(o.guests.grantOptions(resource.ParentResourceId, membership.Member.Gid), grant.WithAnnotation(&v2.GrantImmutable{}))
+		permissionGrant, err := membershipGrant(resource, roleName, membership.Member, grantOptions...)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		if permissionGrant != nil {
+			rv = append(rv, permissionGrant)
+		}
+	}
+
+	return rv, pageToken, nil, nil
+}
+
+// projectOwnerGrant returns the grant of the owner entitlement to the owner
+// of the project, or nil for projects without an owner.
+func projectOwnerGrant(resource *v2.Resource) (*v2.Grant, error) {
+	projectTrait, err := rs.GetGroupTrait(resource)
+	if err != nil {
+		return nil, err
+	}
+
+	ownerId, ok := rs.GetProfileStringValue(projectTrait.Profile, "owner_id")
+	if !ok || ownerId == "" {
+		return nil, nil
+	}
+
+	principal, err := rs.NewResourceID(resourceTypeUser, ownerId)
+	if err != nil {
+		return nil, err
+	}
+
+	return grant.NewGrant(resource, projectOwner, principal), nil
+}
+
+// Grant transfers ownership of the project to the user. Only the owner
+// entitlement can be granted.
+func (o *projectResourceType) Grant(ctx context.Context, resource *v2.Resource, entitlement *v2.Entitlement) ([]*v2.Grant, annotations.Annotations, error) {
+	if resource.Id.ResourceType != resourceTypeUser.Id {
+		return nil, nil, fmt.Errorf("baton-asana: grant not implemented resource type %s", resource.Id.ResourceType)
+	}
+
+	roleName, err := getRoleName(entitlement)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if roleName != projectOwner {
+		return nil, nil, fmt.Errorf("baton-asana: only project owner role can be granted")
+	}
+
+	projectId := entitlement.Resource.Id.Resource
+	userId := resource.Id.Resource
+
+	err = o.client.SetProjectOwner(ctx, projectId, userId)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	userRsId, err := rs.NewResourceID(resourceTypeUser, userId)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rv := []*v2.Grant{
+		grant.NewGrant(entitlement.Resource, roleName, userRsId),
+	}
+
+	return rv, nil, nil
+}
+
+// Revoke refuses to remove the owner of a project, since a project would be
+// left without owner. Ownership is transferred by granting the owner
+// entitlement to the replacement instead.
+func (o *projectResourceType) Revoke(ctx context.Context, grant *v2.Grant) (annotations.Annotations, error) {
+	roleName, err := getRoleName(grant.Entitlement)
+	if err != nil {
+		return nil, err
+	}
+
+	if roleName == projectOwner {
+		return nil, fmt.Errorf("baton-asana: cannot revoke the owner of project %s without a replacement, grant %s to the new owner instead", grant.Entitlement.Resource.Id.Resource, projectOwner)
+	}
+
+	return nil, fmt.Errorf("baton-asana: revoke not implemented for project role %s", roleName)
+}
+
+func projectBuilder(client *asana.Client, sensitiveProjects []string, guests *guestDirectory) *projectResourceType {
+	return &projectResourceType{
+		resourceType:      resourceTypeProject,
+		client:            client,
+		sensitiveProjects: sensitiveProjects,
+		guests:            guests,
+	}
+}
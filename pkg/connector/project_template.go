@@ -0,0 +1,166 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/conductorone/baton-asana/pkg/asana"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	ent "github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	grant "github.com/conductorone/baton-sdk/pkg/types/grant"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+)
+
+const (
+	projectTemplateOwner  = "Owner"
+	projectTemplateViewer = "Viewer"
+)
+
+type projectTemplateResourceType struct {
+	resourceType *v2.ResourceType
+	client       *asana.Client
+}
+
+func (o *projectTemplateResourceType) ResourceType(_ context.Context) *v2.ResourceType {
+	return o.resourceType
+}
+
+// Create a new connector resource for an Asana project template.
+func projectTemplateResource(projectTemplate *asana.ProjectTemplate, parentResourceID *v2.ResourceId) (*v2.Resource, error) {
+	requestedRoles := make([]string, 0, len(projectTemplate.RequestedRoles))
+	for _, role := range projectTemplate.RequestedRoles {
+		requestedRoles = append(requestedRoles, role.Name)
+	}
+
+	profile := map[string]interface{}{
+		"project_template_id":   projectTemplate.Gid,
+		"project_template_name": projectTemplate.Name,
+		"public":                projectTemplate.Public,
+		"requested_roles":       toInterfaceSlice(requestedRoles),
+	}
+	if projectTemplate.Team != nil {
+		profile["team_id"] = projectTemplate.Team.Gid
+		profile["team_name"] = projectTemplate.Team.Name
+	}
+	if projectTemplate.Owner != nil {
+		profile["owner_id"] = projectTemplate.Owner.Gid
+		profile["owner_name"] = projectTemplate.Owner.Name
+	}
+
+	groupTraitOptions := []rs.GroupTraitOption{rs.WithGroupProfile(profile)}
+
+	opts := []rs.ResourceOption{rs.WithParentResourceID(parentResourceID)}
+	if projectTemplate.Description != "" {
+		opts = append(opts, rs.WithDescription(projectTemplate.Description))
+	}
+
+	return rs.NewGroupResource(
+		projectTemplate.Name,
+		resourceTypeProjectTemplate,
+		projectTemplate.Gid,
+		groupTraitOptions,
+		opts...,
+	)
+}
+
+func (o *projectTemplateResourceType) List(ctx context.Context, parentId *v2.ResourceId, token *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	if parentId == nil {
+		return nil, "", nil, nil
+	}
+
+	bag, err := parsePageToken(token.Token, &v2.ResourceId{ResourceType: resourceTypeProjectTemplate.Id})
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	projectTemplates, nextToken, resp, err := o.client.GetProjectTemplates(ctx, asana.GetProjectTemplatesVars{WorkspaceId: parentId.Resource, Limit: ResourcesPageSize, Offset: bag.PageToken()})
+	if err != nil {
+		// Workspaces on plans without project templates have none to sync.
+		if isUnavailable(resp) {
+			return nil, "", nil, nil
+		}
+		return nil, "", nil, fmt.Errorf("baton-asana: failed to list project templates: %w", err)
+	}
+
+	pageToken, err := bag.NextToken(nextToken)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	var rv []*v2.Resource
+	for _, projectTemplate := range projectTemplates {
+		projectTemplateCopy := projectTemplate
+		pr, err := projectTemplateResource(&projectTemplateCopy, parentId)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		rv = append(rv, pr)
+	}
+
+	return rv, pageToken, nil, nil
+}
+
+func (o *projectTemplateResourceType) Entitlements(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	rv := []*v2.Entitlement{
+		ent.NewPermissionEntitlement(resource, projectTemplateOwner,
+			ent.WithGrantableTo(resourceTypeUser),
+			ent.WithDescription(fmt.Sprintf("Owner of %s Asana project template", resource.DisplayName)),
+			ent.WithDisplayName(fmt.Sprintf("%s Project Template %s", resource.DisplayName, projectTemplateOwner)),
+		),
+		ent.NewPermissionEntitlement(resource, projectTemplateViewer,
+			ent.WithGrantableTo(resourceTypeTeam, resourceTypeWorkspace),
+			ent.WithDescription(fmt.Sprintf("Can create projects from %s Asana project template", resource.DisplayName)),
+			ent.WithDisplayName(fmt.Sprintf("%s Project Template %s", resource.DisplayName, projectTemplateViewer)),
+		),
+	}
+	return rv, "", nil, nil
+}
+
+// Grants returns the owner of the project template and who can use it: the
+// members of its team, or every member of the workspace for public templates.
+func (o *projectTemplateResourceType) Grants(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	projectTemplateTrait, err := rs.GetGroupTrait(resource)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	profile := projectTemplateTrait.Profile
+
+	var rv []*v2.Grant
+
+	if ownerId, ok := rs.GetProfileStringValue(profile, "owner_id"); ok && ownerId != "" {
+		principal, err := rs.NewResourceID(resourceTypeUser, ownerId)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		rv = append(rv, grant.NewGrant(resource, projectTemplateOwner, principal))
+	}
+
+	if teamId, ok := rs.GetProfileStringValue(profile, "team_id"); ok && teamId != "" {
+		teamGrant, err := membershipGrant(resource, projectTemplateViewer, asana.BaseResource{Gid: teamId, ResourceType: resourceTypeTeam.Id})
+		if err != nil {
+			return nil, "", nil, err
+		}
+		rv = append(rv, teamGrant)
+	}
+
+	if profile.GetFields()["public"].GetBoolValue() && resource.ParentResourceId != nil {
+		workspace := &v2.Resource{Id: resource.ParentResourceId}
+		rv = append(rv, grant.NewGrant(resource, projectTemplateViewer, resource.ParentResourceId, grant.WithAnnotation(&v2.GrantExpandable{
+			EntitlementIds: []string{
+				ent.NewEntitlementID(workspace, member),
+				ent.NewEntitlementID(workspace, admin),
+			},
+		})))
+	}
+
+	return rv, "", nil, nil
+}
+
+func projectTemplateBuilder(client *asana.Client) *projectTemplateResourceType {
+	return &projectTemplateResourceType{
+		resourceType: resourceTypeProjectTemplate,
+		client:       client,
+	}
+}
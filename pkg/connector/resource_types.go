@@ -0,0 +1,153 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/connectorbuilder"
+	"google.golang.org/protobuf/proto"
+)
+
+// allResourceTypes lists every resource type synced by the connector, which
+// can be selected by id.
+var allResourceTypes = []*v2.ResourceType{
+	resourceTypeUser,
+	resourceTypeWorkspace,
+	resourceTypeTeam,
+	resourceTypeProject,
+	resourceTypePortfolio,
+	resourceTypeCustomField,
+	resourceTypeTask,
+	resourceTypeProjectTemplate,
+}
+
+// resourceTypeParents maps the ids of resource types to the id of the resource
+// type they are listed under, without which nothing of them is synced.
+var resourceTypeParents = map[string]string{
+	resourceTypeUser.Id:            resourceTypeWorkspace.Id,
+	resourceTypeTeam.Id:            resourceTypeWorkspace.Id,
+	resourceTypeProject.Id:         resourceTypeWorkspace.Id,
+	resourceTypePortfolio.Id:       resourceTypeWorkspace.Id,
+	resourceTypeCustomField.Id:     resourceTypeWorkspace.Id,
+	resourceTypeProjectTemplate.Id: resourceTypeWorkspace.Id,
+	resourceTypeTask.Id:            resourceTypeProject.Id,
+}
+
+// ValidateResourceTypes checks that the given resource type ids are known,
+// and that every enabled resource type is enabled along with the resource
+// type it is listed under.
+func ValidateResourceTypes(enabled, skipGrants []string) error {
+	for _, id := range slices.Concat(enabled, skipGrants) {
+		if !slices.ContainsFunc(allResourceTypes, func(rt *v2.ResourceType) bool { return rt.Id == id }) {
+			return fmt.Errorf("baton-asana: unknown resource type %q", id)
+		}
+	}
+
+	if len(enabled) == 0 {
+		return nil
+	}
+	for _, id := range enabled {
+		if parent, ok := resourceTypeParents[id]; ok && !slices.Contains(enabled, parent) {
+			return fmt.Errorf("baton-asana: resource type %q requires %q, which it is listed under", id, parent)
+		}
+	}
+
+	return nil
+}
+
+// resourceTypeSelection configures which resource types are synced, and which
+// of those are synced without their entitlements and grants.
+type resourceTypeSelection struct {
+	// enabled lists the ids of the synced resource types. When empty every
+	// resource type is synced.
+	enabled []string
+	// skipGrants lists the ids of the resource types whose entitlements and
+	// grants are not synced.
+	skipGrants []string
+}
+
+// newResourceTypeSelection returns the selection of the given resource type
+// ids, failing for unknown ids and resource types enabled without their
+// parent.
+func newResourceTypeSelection(enabled, skipGrants []string) (*resourceTypeSelection, error) {
+	if err := ValidateResourceTypes(enabled, skipGrants); err != nil {
+		return nil, err
+	}
+
+	return &resourceTypeSelection{
+		enabled:    enabled,
+		skipGrants: skipGrants,
+	}, nil
+}
+
+// apply drops the syncers of resource types that are not enabled and marks
+// those whose grants are skipped with the SkipEntitlementsAndGrants
+// annotation.
+func (s *resourceTypeSelection) apply(ctx context.Context, syncers []connectorbuilder.ResourceSyncer) []connectorbuilder.ResourceSyncer {
+	if s == nil {
+		return syncers
+	}
+
+	rv := make([]connectorbuilder.ResourceSyncer, 0, len(syncers))
+	for _, syncer := range syncers {
+		resourceType := syncer.ResourceType(ctx)
+		if !s.syncs(resourceType.Id) {
+			continue
+		}
+		if slices.Contains(s.skipGrants, resourceType.Id) {
+			syncer = withoutGrants(syncer, resourceType)
+		}
+		rv = append(rv, syncer)
+	}
+
+	return rv
+}
+
+// syncs reports whether the resource type with the given id is synced.
+func (s *resourceTypeSelection) syncs(id string) bool {
+	return s == nil || len(s.enabled) == 0 || slices.Contains(s.enabled, id)
+}
+
+// skipGrantsSyncer overrides the resource type of a syncer with a copy
+// annotated with SkipEntitlementsAndGrants.
+type skipGrantsSyncer struct {
+	connectorbuilder.ResourceSyncer
+	resourceType *v2.ResourceType
+}
+
+func (s *skipGrantsSyncer) ResourceType(_ context.Context) *v2.ResourceType {
+	return s.resourceType
+}
+
+// skipGrantsProvisioner is a skipGrantsSyncer for a syncer that can also
+// grant and revoke, so that provisioning keeps working when grants are not
+// synced.
+type skipGrantsProvisioner struct {
+	*skipGrantsSyncer
+	provisioner connectorbuilder.ResourceProvisionerV2
+}
+
+func (s *skipGrantsProvisioner) Grant(ctx context.Context, resource *v2.Resource, entitlement *v2.Entitlement) ([]*v2.Grant, annotations.Annotations, error) {
+	return s.provisioner.Grant(ctx, resource, entitlement)
+}
+
+func (s *skipGrantsProvisioner) Revoke(ctx context.Context, grant *v2.Grant) (annotations.Annotations, error) {
+	return s.provisioner.Revoke(ctx, grant)
+}
+
+func withoutGrants(syncer connectorbuilder.ResourceSyncer, resourceType *v2.ResourceType) connectorbuilder.ResourceSyncer {
+	// The resource type is copied since resource type variables are shared.
+	annotated, _ := proto.Clone(resourceType).(*v2.ResourceType)
+	annos := annotations.Annotations(annotated.Annotations)
+	annos.Update(&v2.SkipEntitlementsAndGrants{})
+	annotated.Annotations = annos
+
+	wrapped := &skipGrantsSyncer{ResourceSyncer: syncer, resourceType: annotated}
+	if provisioner, ok := syncer.(connectorbuilder.ResourceProvisionerV2); ok {
+		return &skipGrantsProvisioner{skipGrantsSyncer: wrapped, provisioner: provisioner}
+	}
+	return wrapped
+}
@@ -0,0 +1,74 @@
+package connector
+
+import (
+	"context"
+	"sync"
+
+	"github.com/conductorone/baton-asana/pkg/asana"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+)
+
+// scimDirectory holds the SCIM records of users, which carry the title and
+// department Enterprise organizations populate from their HR systems. The
+// records are listed once, the first time a user is looked up.
+type scimDirectory struct {
+	client       *asana.Client
+	capabilities *capabilities
+
+	mu     sync.Mutex
+	loaded bool
+	users  map[string]asana.ScimUser
+}
+
+func newScimDirectory(client *asana.Client, caps *capabilities) *scimDirectory {
+	return &scimDirectory{
+		client:       client,
+		capabilities: caps,
+	}
+}
+
+// user returns the SCIM record of a user, if the credentials can use SCIM
+// and the user was provisioned through it.
+func (d *scimDirectory) user(ctx context.Context, userId string) (asana.ScimUser, bool, error) {
+	if d == nil || !d.capabilities.canUseScim() {
+		return asana.ScimUser{}, false, nil
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !d.loaded {
+		users := make(map[string]asana.ScimUser)
+		for scimUser, err := range d.client.AllScimUsers(ctx) {
+			if err != nil {
+				return asana.ScimUser{}, false, err
+			}
+			users[scimUser.Id] = scimUser
+		}
+		ctxzap.Extract(ctx).Debug("baton-asana: loaded SCIM users", zap.Int("users", len(users)))
+		d.users = users
+		d.loaded = true
+	}
+
+	scimUser, ok := d.users[userId]
+	return scimUser, ok, nil
+}
+
+// profile returns the title and department of a user as user profile fields.
+func (d *scimDirectory) profile(ctx context.Context, userId string) (map[string]interface{}, error) {
+	scimUser, ok, err := d.user(ctx, userId)
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	profile := make(map[string]interface{})
+	if scimUser.Title != "" {
+		profile["title"] = scimUser.Title
+	}
+	if scimUser.Enterprise != nil && scimUser.Enterprise.Department != "" {
+		profile["department"] = scimUser.Enterprise.Department
+	}
+
+	return profile, nil
+}
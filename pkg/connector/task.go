@@ -0,0 +1,200 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"sync"
+
+	"github.com/conductorone/baton-asana/pkg/asana"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	ent "github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	"github.com/conductorone/baton-sdk/pkg/types/grant"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+)
+
+const taskCollaborator = "Collaborator"
+
+// DefaultSensitiveTaskPageLimit is the number of pages of tasks scanned per
+// sensitive project when no limit is configured.
+const DefaultSensitiveTaskPageLimit = 10
+
+type taskResourceType struct {
+	resourceType *v2.ResourceType
+	client       *asana.Client
+	// sensitiveProjects lists the gids of the projects whose tasks are synced.
+	sensitiveProjects []string
+	// pageLimit bounds the pages of tasks scanned per sensitive project.
+	pageLimit int
+
+	mu sync.Mutex
+	// members caches the members of each sensitive project across the pages
+	// of its tasks.
+	members map[string]map[string]bool
+}
+
+func (o *taskResourceType) ResourceType(_ context.Context) *v2.ResourceType {
+	return o.resourceType
+}
+
+// Create a new connector resource for an Asana task shared with users outside its project.
+func taskResource(task *asana.Task, outsiders []string, parentResourceID *v2.ResourceId) (*v2.Resource, error) {
+	return rs.NewResource(
+		task.Name,
+		resourceTypeTask,
+		task.Gid,
+		rs.WithParentResourceID(parentResourceID),
+		rs.WithDescription(fmt.Sprintf("Followed by %d users who are not members of the project", len(outsiders))),
+	)
+}
+
+// projectMemberIds returns the gids of the users who are members of a
+// project, either directly or through a team.
+func (o *taskResourceType) projectMemberIds(ctx context.Context, projectId string) (map[string]bool, error) {
+	o.mu.Lock()
+	members, ok := o.members[projectId]
+	o.mu.Unlock()
+	if ok {
+		return members, nil
+	}
+
+	members = make(map[string]bool)
+	for membership, err := range o.client.AllMemberships(ctx, projectId) {
+		if err != nil {
+			return nil, err
+		}
+
+		switch membership.Member.ResourceType {
+		case resourceTypeUser.Id:
+			members[membership.Member.Gid] = true
+		case resourceTypeTeam.Id:
+			for teamMembership, err := range o.client.AllTeamMemberships(ctx, membership.Member.Gid) {
+				if err != nil {
+					return nil, err
+				}
+				members[teamMembership.User.Gid] = true
+			}
+		}
+	}
+
+	o.mu.Lock()
+	o.members[projectId] = members
+	o.mu.Unlock()
+
+	return members, nil
+}
+
+// List returns the tasks of a sensitive project followed by users who are not
+// members of the project, scanning one page of tasks per call and at most
+// pageLimit pages.
+func (o *taskResourceType) List(ctx context.Context, parentId *v2.ResourceId, token *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	if parentId == nil || parentId.ResourceType != resourceTypeProject.Id || !slices.Contains(o.sensitiveProjects, parentId.Resource) {
+		return nil, "", nil, nil
+	}
+
+	// The resource id of the page state counts the pages scanned so far.
+	bag, err := parsePageToken(token.Token, &v2.ResourceId{ResourceType: resourceTypeTask.Id, Resource: "0"})
+	if err != nil {
+		return nil, "", nil, err
+	}
+	scanned, err := strconv.Atoi(bag.ResourceID())
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("baton-asana: invalid task page state %q", bag.ResourceID())
+	}
+	if scanned >= o.pageLimit {
+		return nil, "", nil, nil
+	}
+
+	members, err := o.projectMemberIds(ctx, parentId.Resource)
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("baton-asana: failed to list members of project %s: %w", parentId.Resource, err)
+	}
+
+	tasks, nextOffset, _, err := o.client.GetProjectTasks(ctx, asana.GetProjectTasksVars{ProjectId: parentId.Resource, Limit: asana.MaxPageSize, Offset: bag.PageToken()})
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("baton-asana: failed to list tasks: %w", err)
+	}
+
+	var pageToken string
+	if nextOffset != "" && scanned+1 < o.pageLimit {
+		bag.Pop()
+		bag.Push(pagination.PageState{
+			ResourceTypeID: resourceTypeTask.Id,
+			ResourceID:     strconv.Itoa(scanned + 1),
+			Token:          nextOffset,
+		})
+		pageToken, err = bag.Marshal()
+		if err != nil {
+			return nil, "", nil, err
+		}
+	}
+
+	var rv []*v2.Resource
+	for _, task := range tasks {
+		var outsiders []string
+		for _, follower := range task.Followers {
+			if !members[follower.Gid] {
+				outsiders = append(outsiders, follower.Gid)
+			}
+		}
+		if len(outsiders) == 0 {
+			continue
+		}
+
+		taskCopy := task
+		tr, err := taskResource(&taskCopy, outsiders, parentId)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		rv = append(rv, tr)
+	}
+
+	return rv, pageToken, nil, nil
+}
+
+func (o *taskResourceType) Entitlements(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	rv := []*v2.Entitlement{
+		ent.NewPermissionEntitlement(resource, taskCollaborator,
+			ent.WithGrantableTo(resourceTypeUser),
+			ent.WithDescription(fmt.Sprintf("Collaborator on %s Asana task", resource.DisplayName)),
+			ent.WithDisplayName(fmt.Sprintf("%s Task %s", resource.DisplayName, taskCollaborator)),
+		),
+	}
+
+	return rv, "", nil, nil
+}
+
+func (o *taskResourceType) Grants(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	task, err := o.client.GetTask(ctx, resource.Id.Resource)
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("baton-asana: failed to get task %s: %w", resource.Id.Resource, err)
+	}
+
+	var rv []*v2.Grant
+	for _, follower := range task.Followers {
+		principal, err := rs.NewResourceID(resourceTypeUser, follower.Gid)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		rv = append(rv, grant.NewGrant(resource, taskCollaborator, principal))
+	}
+
+	return rv, "", nil, nil
+}
+
+func taskBuilder(client *asana.Client, sensitiveProjects []string, pageLimit int) *taskResourceType {
+	if pageLimit < 1 {
+		pageLimit = DefaultSensitiveTaskPageLimit
+	}
+
+	return &taskResourceType{
+		resourceType:      resourceTypeTask,
+		client:            client,
+		sensitiveProjects: sensitiveProjects,
+		pageLimit:         pageLimit,
+		members:           make(map[string]map[string]bool),
+	}
+}
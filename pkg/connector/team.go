@@ -2,8 +2,11 @@ package connector
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/conductorone/baton-asana/pkg/asana"
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
@@ -12,6 +15,10 @@ import (
 	ent "github.com/conductorone/baton-sdk/pkg/types/entitlement"
 	grant "github.com/conductorone/baton-sdk/pkg/types/grant"
 	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 const (
@@ -21,6 +28,14 @@ const (
 	teamMember        = "Team Member"
 )
 
+// teamPendingMember is the entitlement of users whose request to join a team
+// awaits approval. It is not a role of the team, so it is not in teamRoles.
+const teamPendingMember = "Pending Member"
+
+// teamJoinRequestsPageState is the page state of the second phase of team
+// grants, listing pending join requests after the memberships.
+const teamJoinRequestsPageState = "team_join_requests"
+
 var teamRoles = []string{
 	teamGuest,
 	teamAdmin,
@@ -31,6 +46,22 @@ var teamRoles = []string{
 type teamResourceType struct {
 	resourceType *v2.ResourceType
 	client       *asana.Client
+	capabilities *capabilities
+
+	// prefetchWorkers enables fetching all memberships of listed teams
+	// concurrently. When zero only first pages are fetched in batches.
+	prefetchWorkers int
+	// export serves teams and their memberships from organization exports
+	// when bulk sync is enabled.
+	export *orgExportSource
+	// guests flags the memberships of guests when the guest access report
+	// is enabled.
+	guests *guestDirectory
+
+	mu sync.Mutex
+	// first pages of team memberships fetched while listing teams,
+	// consumed by the first Grants call of each team.
+	membershipPages map[string]asana.TeamMembershipsPage
 }
 
 func (o *teamResourceType) ResourceType(_ context.Context) *v2.ResourceType {
@@ -43,6 +74,9 @@ func teamResource(team *asana.Team, parentResourceID *v2.ResourceId) (*v2.Resour
 		"team_id":   team.Gid,
 		"team_name": team.Name,
 	}
+	if team.Visibility != "" {
+		profile["visibility"] = team.Visibility
+	}
 
 	groupTraitOptions := []rs.GroupTraitOption{rs.WithGroupProfile(profile)}
 
@@ -70,7 +104,18 @@ func (o *teamResourceType) List(ctx context.Context, parentId *v2.ResourceId, to
 		return nil, "", nil, err
 	}
 
-	teams, nextToken, _, err := o.client.GetTeams(ctx, asana.GetTeamsVars{WorkspaceId: parentId.Resource, Offset: bag.PageToken(), Limit: ResourcesPageSize})
+	export, err := o.export.load(ctx, parentId.Resource)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	var teams []asana.Team
+	var nextToken string
+	if export != nil {
+		teams, nextToken, err = pageSlice(export.Teams, bag.PageToken(), ResourcesPageSize)
+	} else {
+		teams, nextToken, _, err = o.client.GetTeams(ctx, asana.GetTeamsVars{WorkspaceId: parentId.Resource, Offset: bag.PageToken(), Limit: ResourcesPageSize})
+	}
 	if err != nil {
 		return nil, "", nil, fmt.Errorf("baton-asana: failed to list teams: %w", err)
 	}
@@ -81,6 +126,7 @@ func (o *teamResourceType) List(ctx context.Context, parentId *v2.ResourceId, to
 	}
 
 	var rv []*v2.Resource
+	teamIds := make([]string, 0, len(teams))
 	for _, team := range teams {
 		teamCopy := team
 		ur, err := teamResource(&teamCopy, parentId)
@@ -88,7 +134,19 @@ func (o *teamResourceType) List(ctx context.Context, parentId *v2.ResourceId, to
 			return nil, "", nil, err
 		}
 		rv = append(rv, ur)
+		teamIds = append(teamIds, team.Gid)
+	}
+
+	if export != nil {
+		o.mu.Lock()
+		for _, teamId := range teamIds {
+			o.membershipPages[teamId] = asana.TeamMembershipsPage{Memberships: export.TeamMemberships[teamId]}
+		}
+		o.mu.Unlock()
+	} else {
+		o.prefetchMembershipPages(ctx, teamIds)
 	}
+
 	return rv, pageToken, nil, nil
 }
 
@@ -104,6 +162,17 @@ func (o *teamResourceType) Entitlements(_ context.Context, resource *v2.Resource
 		permissionEn := ent.NewPermissionEntitlement(resource, role, permissionOptions...)
 		rv = append(rv, permissionEn)
 	}
+
+	// Join requests are made by users in Asana and approved by granting team
+	// membership, so the pending member entitlement cannot be provisioned.
+	pendingOptions := []ent.EntitlementOption{
+		ent.WithGrantableTo(resourceTypeUser),
+		ent.WithDescription(fmt.Sprintf("Pending request to join %s Asana team", resource.DisplayName)),
+		ent.WithDisplayName(fmt.Sprintf("%s Team %s", resource.DisplayName, teamPendingMember)),
+		ent.WithAnnotation(&v2.EntitlementImmutable{}),
+	}
+	rv = append(rv, ent.NewPermissionEntitlement(resource, teamPendingMember, pendingOptions...))
+
 	return rv, "", nil, nil
 }
 
@@ -123,12 +192,11 @@ func (o *teamResourceType) Grants(ctx context.Context, resource *v2.Resource, to
 		return nil, "", nil, fmt.Errorf("error fetching team_id from team profile")
 	}
 
-	teamMemberships, offset, _, err := o.client.GetTeamMemberships(ctx, asana.GetTeamMembershipsVars{TeamId: teamId, Limit: ResourcesPageSize, Offset: bag.PageToken()})
-	if err != nil {
-		return nil, "", nil, err
+	if bag.ResourceTypeID() == teamJoinRequestsPageState {
+		return o.joinRequestGrants(ctx, resource, teamId, bag)
 	}
 
-	pageToken, err := bag.NextToken(offset)
+	teamMemberships, offset, err := o.getTeamMemberships(ctx, teamId, bag.PageToken())
 	if err != nil {
 		return nil, "", nil, err
 	}
@@ -148,20 +216,83 @@ func (o *teamResourceType) Grants(ctx context.Context, resource *v2.Resource, to
 			roleName = teamMember
 		}
 		teamMembershipCopy := teamMembership
-		ur, err := userResource(ctx, &teamMembershipCopy.User, resource.Id)
+		ur, err := userResource(&teamMembershipCopy.User, resource.Id)
 		if err != nil {
 			return nil, "", nil, err
 		}
 
-		permissionGrant := grant.NewGrant(resource, roleName, ur.Id, getTeamGrantAnnotations(roleName)...)
+		grantOptions := append(getTeamGrantAnnotations(roleName), o.guests.grantOptions(resource.ParentResourceId, ur.Id.Resource)...)
+		permissionGrant := grant.NewGrant(resource, roleName, ur.Id, grantOptions...)
 		rv = append(rv, permissionGrant)
 	}
 
+	visibility, _ := rs.GetProfileStringValue(teamTrait.Profile, "visibility")
+	if offset != "" || visibility != asana.TeamVisibilityRequestToJoin || !o.capabilities.canReadJoinRequests() {
+		pageToken, err := bag.NextToken(offset)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		return rv, pageToken, nil, nil
+	}
+
+	bag.Pop()
+	bag.Push(pagination.PageState{
+		ResourceTypeID: teamJoinRequestsPageState,
+		ResourceID:     teamId,
+	})
+	pageToken, err := bag.Marshal()
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	return rv, pageToken, nil, nil
+}
+
+// joinRequestGrants returns the pending requests to join a team as grants of
+// the pending member entitlement. Join requests are skipped from then on when
+// they cannot be listed.
+func (o *teamResourceType) joinRequestGrants(ctx context.Context, resource *v2.Resource, teamId string, bag *pagination.Bag) ([]*v2.Grant, string, annotations.Annotations, error) {
+	joinRequests, offset, resp, err := o.client.GetTeamJoinRequests(ctx, asana.GetTeamJoinRequestsVars{TeamId: teamId, Limit: ResourcesPageSize, Offset: bag.PageToken()})
+	if err != nil {
+		if isUnavailable(resp) {
+			ctxzap.Extract(ctx).Debug("baton-asana: team join requests are unavailable", zap.String("team_id", teamId), zap.Error(err))
+			o.capabilities.disableJoinRequests()
+			return nil, "", nil, nil
+		}
+		return nil, "", nil, err
+	}
+
+	pageToken, err := bag.NextToken(offset)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	var rv []*v2.Grant
+	for _, joinRequest := range joinRequests {
+		userId, err := rs.NewResourceID(resourceTypeUser, joinRequest.User.Gid)
+		if err != nil {
+			return nil, "", nil, err
+		}
+
+		metadata := map[string]interface{}{"join_request_id": joinRequest.Gid}
+		if !joinRequest.CreatedAt.IsZero() {
+			metadata["requested_at"] = joinRequest.CreatedAt.Format(time.RFC3339)
+		}
+		rv = append(rv, grant.NewGrant(resource, teamPendingMember, userId,
+			grant.WithGrantMetadata(metadata),
+			grant.WithAnnotation(&v2.GrantImmutable{}),
+		))
+	}
+
 	return rv, pageToken, nil, nil
 }
 
 func (o *teamResourceType) Grant(ctx context.Context, resource *v2.Resource, entitlement *v2.Entitlement) ([]*v2.Grant, annotations.Annotations, error) {
 	if resource.Id.ResourceType == resourceTypeUser.Id {
+		if err := o.capabilities.canProvision(); err != nil {
+			return nil, nil, err
+		}
+
 		teamId := entitlement.Resource.Id.Resource
 		userId := resource.Id.Resource
 
@@ -179,16 +310,38 @@ func (o *teamResourceType) Grant(ctx context.Context, resource *v2.Resource, ent
 			return nil, nil, err
 		}
 
-		err = o.client.AddUserToTeam(ctx, teamId, userId)
+		team, err := o.client.GetTeam(ctx, teamId)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// Pending requests to join are approved rather than adding the user,
+		// so that the request does not linger in Asana.
+		approved, err := o.approveJoinRequest(ctx, team, userId)
 		if err != nil {
 			return nil, nil, err
 		}
 
+		var annos annotations.Annotations
+		if !approved {
+			err = o.client.AddUserToTeam(ctx, teamId, userId)
+		}
+		switch {
+		case errors.Is(err, asana.ErrAlreadyMember):
+			annos.Update(&v2.GrantAlreadyExists{})
+		case err != nil:
+			return nil, nil, err
+		default:
+			if err := o.verifyAdded(ctx, team, userId); err != nil {
+				return nil, nil, err
+			}
+		}
+
 		var rv []*v2.Grant
 		permissionGrant := grant.NewGrant(resource, roleName, userRsId)
 		rv = append(rv, permissionGrant)
 
-		return rv, nil, nil
+		return rv, annos, nil
 	}
 
 	return nil, nil, fmt.Errorf("baton-asana: grant not implemented resource type %s", resource.Id.ResourceType)
@@ -196,25 +349,122 @@ func (o *teamResourceType) Grant(ctx context.Context, resource *v2.Resource, ent
 
 func (o *teamResourceType) Revoke(ctx context.Context, grant *v2.Grant) (annotations.Annotations, error) {
 	if grant.Principal.Id.ResourceType == resourceTypeUser.Id {
+		if err := o.capabilities.canProvision(); err != nil {
+			return nil, err
+		}
+
+		roleName, err := getRoleName(grant.Entitlement)
+		if err != nil {
+			return nil, err
+		}
+		if roleName == teamPendingMember {
+			return nil, fmt.Errorf("baton-asana: pending requests to join a team cannot be revoked, they must be declined in Asana")
+		}
+
 		teamId := grant.Entitlement.Resource.Id.Resource
 		userId := grant.Principal.Id.Resource
 
-		err := o.client.RemoveUserToTeam(ctx, teamId, userId)
+		err = o.client.RemoveUserToTeam(ctx, teamId, userId)
 		if err != nil {
+			if errors.Is(err, asana.ErrNotMember) {
+				return annotations.New(&v2.GrantAlreadyRevoked{}), nil
+			}
 			return nil, err
 		}
 
+		removed, err := verify(ctx, func(ctx context.Context) (bool, error) {
+			membership, err := o.client.GetTeamMembership(ctx, teamId, userId)
+			return membership == nil, err
+		})
+		if err != nil {
+			return nil, err
+		}
+		if !removed {
+			return nil, fmt.Errorf("baton-asana: user %s was removed from team %s but is still a member", userId, teamId)
+		}
+
 		return nil, nil
 	}
 
 	return nil, fmt.Errorf("baton-asana: revoke not implemented resource type %s", grant.Principal.Id.ResourceType)
 }
 
-func teamBuilder(client *asana.Client) *teamResourceType {
+// verifyAdded checks that a user added to a team became a member. Users
+// added to teams requiring a request to join may only be left with a pending
+// join request, which is reported as a failed precondition until the request
+// is approved in Asana.
+func (o *teamResourceType) verifyAdded(ctx context.Context, team asana.Team, userId string) error {
+	added, err := verify(ctx, func(ctx context.Context) (bool, error) {
+		membership, err := o.client.GetTeamMembership(ctx, team.Gid, userId)
+		return membership != nil, err
+	})
+	if err != nil || added {
+		return err
+	}
+
+	if team.Visibility != asana.TeamVisibilityRequestToJoin {
+		return fmt.Errorf("baton-asana: user %s was added to team %s but is not a member", userId, team.Gid)
+	}
+
+	return status.Errorf(codes.FailedPrecondition, "baton-asana: membership pending, user %s requested to join team %s and awaits approval", userId, team.Gid)
+}
+
+// approveJoinRequest approves the pending request of a user to join a team,
+// if there is one. It reports whether a request was approved.
+func (o *teamResourceType) approveJoinRequest(ctx context.Context, team asana.Team, userId string) (bool, error) {
+	if team.Visibility != asana.TeamVisibilityRequestToJoin || !o.capabilities.canReadJoinRequests() {
+		return false, nil
+	}
+
+	offset := ""
+	for {
+		joinRequests, nextOffset, resp, err := o.client.GetTeamJoinRequests(ctx, asana.GetTeamJoinRequestsVars{TeamId: team.Gid, Limit: asana.MaxPageSize, Offset: offset})
+		if err != nil {
+			if isUnavailable(resp) {
+				o.capabilities.disableJoinRequests()
+				return false, nil
+			}
+			return false, err
+		}
+
+		for _, joinRequest := range joinRequests {
+			if joinRequest.User.Gid != userId {
+				continue
+			}
+			if err := o.client.ApproveTeamJoinRequest(ctx, joinRequest.Gid); err != nil {
+				return false, fmt.Errorf("baton-asana: failed to approve request %s to join team %s: %w", joinRequest.Gid, team.Gid, err)
+			}
+			return true, nil
+		}
+
+		if nextOffset == "" {
+			return false, nil
+		}
+		offset = nextOffset
+	}
+}
+
+func teamBuilder(client *asana.Client, capabilities *capabilities, prefetchWorkers int, export *orgExportSource, guests *guestDirectory) *teamResourceType {
 	return &teamResourceType{
-		resourceType: resourceTypeTeam,
-		client:       client,
+		resourceType:    resourceTypeTeam,
+		client:          client,
+		capabilities:    capabilities,
+		prefetchWorkers: prefetchWorkers,
+		export:          export,
+		guests:          guests,
+		membershipPages: make(map[string]asana.TeamMembershipsPage),
+	}
+}
+
+// teamMembershipEntitlementIds returns the ids of the entitlements of every
+// team role, which together make up the members of the team.
+func teamMembershipEntitlementIds(teamId *v2.ResourceId) []string {
+	team := &v2.Resource{Id: teamId}
+	rv := make([]string, 0, len(teamRoles))
+	for _, role := range teamRoles {
+		rv = append(rv, ent.NewEntitlementID(team, role))
 	}
+	return rv
 }
 
 func getRoleName(entitlement *v2.Entitlement) (string, error) {
@@ -0,0 +1,100 @@
+package connector
+
+import (
+	"context"
+	"sync"
+
+	"github.com/conductorone/baton-asana/pkg/asana"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+)
+
+// MaxPrefetchWorkers bounds the concurrent membership requests to a share of
+// the 50 concurrent read requests Asana allows per token, leaving room for
+// the requests of the rest of the sync.
+const MaxPrefetchWorkers = 20
+
+// prefetchMembershipPages caches memberships of the given teams ahead of the
+// Grants calls for them. Failures are not fatal since Grants falls back to
+// fetching the memberships of uncached teams itself.
+func (o *teamResourceType) prefetchMembershipPages(ctx context.Context, teamIds []string) {
+	if len(teamIds) == 0 {
+		return
+	}
+
+	if o.prefetchWorkers > 0 {
+		o.prefetchAllMemberships(ctx, teamIds)
+		return
+	}
+
+	pages, err := o.client.GetTeamMembershipsFirstPages(ctx, teamIds, ResourcesPageSize)
+	if err != nil {
+		ctxzap.Extract(ctx).Warn("baton-asana: failed to prefetch team memberships", zap.Error(err))
+		return
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for teamId, page := range pages {
+		o.membershipPages[teamId] = page
+	}
+}
+
+// prefetchAllMemberships concurrently fetches every membership of the given
+// teams, running at most prefetchWorkers requests at a time.
+func (o *teamResourceType) prefetchAllMemberships(ctx context.Context, teamIds []string) {
+	l := ctxzap.Extract(ctx)
+	workers := make(chan struct{}, o.prefetchWorkers)
+
+	var wg sync.WaitGroup
+	for _, teamId := range teamIds {
+		wg.Add(1)
+		workers <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-workers }()
+
+			var memberships []asana.TeamMembership
+			for teamMembership, err := range o.client.AllTeamMemberships(ctx, teamId) {
+				if err != nil {
+					l.Warn("baton-asana: failed to prefetch team memberships", zap.String("team_id", teamId), zap.Error(err))
+					return
+				}
+				memberships = append(memberships, teamMembership)
+			}
+
+			o.mu.Lock()
+			defer o.mu.Unlock()
+			o.membershipPages[teamId] = asana.TeamMembershipsPage{Memberships: memberships}
+		}()
+	}
+	wg.Wait()
+}
+
+// getTeamMemberships returns a page of memberships of a team, serving the
+// first page from the prefetched results when available.
+func (o *teamResourceType) getTeamMemberships(ctx context.Context, teamId, offset string) ([]asana.TeamMembership, string, error) {
+	if offset == "" {
+		if page, ok := o.takeMembershipPage(teamId); ok {
+			return page.Memberships, page.NextOffset, nil
+		}
+	}
+
+	teamMemberships, nextOffset, _, err := o.client.GetTeamMemberships(ctx, asana.GetTeamMembershipsVars{TeamId: teamId, Limit: ResourcesPageSize, Offset: offset})
+	if err != nil {
+		return nil, "", err
+	}
+
+	return teamMemberships, nextOffset, nil
+}
+
+// takeMembershipPage returns and forgets the prefetched first page of memberships of a team.
+func (o *teamResourceType) takeMembershipPage(teamId string) (asana.TeamMembershipsPage, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	page, ok := o.membershipPages[teamId]
+	if ok {
+		delete(o.membershipPages, teamId)
+	}
+	return page, ok
+}
@@ -2,18 +2,27 @@ package connector
 
 import (
 	"context"
+	"fmt"
 	"strings"
+	"time"
 
 	"github.com/conductorone/baton-asana/pkg/asana"
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
 	"github.com/conductorone/baton-sdk/pkg/annotations"
 	"github.com/conductorone/baton-sdk/pkg/pagination"
 	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
 )
 
 type userResourceType struct {
 	resourceType *v2.ResourceType
 	client       *asana.Client
+	capabilities *capabilities
+	guests       *guestDirectory
+	export       *orgExportSource
+	scim         *scimDirectory
+	activity     *activityDirectory
 }
 
 func (o *userResourceType) ResourceType(_ context.Context) *v2.ResourceType {
@@ -21,7 +30,49 @@ func (o *userResourceType) ResourceType(_ context.Context) *v2.ResourceType {
 }
 
 // Create a new connector resource for an Asana user.
-func userResource(ctx context.Context, user *asana.User, parentResourceID *v2.ResourceId) (*v2.Resource, error) {
+func userResource(user *asana.User, parentResourceID *v2.ResourceId) (*v2.Resource, error) {
+	return newUserResource(user, nil, parentResourceID, rs.WithStatus(v2.UserTrait_Status_STATUS_ENABLED))
+}
+
+// Create a new connector resource for an Asana user from their workspace
+// membership, flagging guests and adding the given extra profile fields.
+func workspaceMemberResource(workspaceMembership *asana.WorkspaceMembership, extraProfile map[string]interface{}, parentResourceID *v2.ResourceId, traitOptions ...rs.UserTraitOption) (*v2.Resource, error) {
+	status := v2.UserTrait_Status_STATUS_ENABLED
+	if !workspaceMembership.IsActive {
+		status = v2.UserTrait_Status_STATUS_DISABLED
+	}
+
+	profile := map[string]interface{}{
+		"guest": workspaceMembership.IsGuest,
+	}
+	if vacation := workspaceMembership.VacationDates; vacation != nil {
+		profile["vacation_start_on"] = vacation.StartOn
+		if vacation.EndOn != "" {
+			profile["vacation_end_on"] = vacation.EndOn
+		}
+	}
+	for k, v := range extraProfile {
+		profile[k] = v
+	}
+	// The profile fields of the membership take precedence over those of SCIM.
+	if workspaceMembership.Title != "" {
+		profile["title"] = workspaceMembership.Title
+	}
+	if workspaceMembership.Department != "" {
+		profile["department"] = workspaceMembership.Department
+	}
+
+	userTraitOptions := []rs.UserTraitOption{rs.WithStatus(status)}
+	if !workspaceMembership.CreatedAt.IsZero() {
+		profile["created_at"] = workspaceMembership.CreatedAt.Format(time.RFC3339)
+		userTraitOptions = append(userTraitOptions, rs.WithCreatedAt(workspaceMembership.CreatedAt))
+	}
+	userTraitOptions = append(userTraitOptions, traitOptions...)
+
+	return newUserResource(&workspaceMembership.User, profile, parentResourceID, userTraitOptions...)
+}
+
+func newUserResource(user *asana.User, extraProfile map[string]interface{}, parentResourceID *v2.ResourceId, traitOptions ...rs.UserTraitOption) (*v2.Resource, error) {
 	names := strings.SplitN(user.Name, " ", 2)
 	var firstName, lastName string
 	switch len(names) {
@@ -38,12 +89,18 @@ func userResource(ctx context.Context, user *asana.User, parentResourceID *v2.Re
 		"login":      user.Email,
 		"user_id":    user.Gid,
 	}
+	for k, v := range extraProfile {
+		profile[k] = v
+	}
 
 	userTraitOptions := []rs.UserTraitOption{
-		rs.WithUserProfile(profile),
 		rs.WithEmail(user.Email, true),
-		rs.WithStatus(v2.UserTrait_Status_STATUS_ENABLED),
 	}
+	if user.Photo != nil && user.Photo.Image128x128 != "" {
+		profile["photo_url"] = user.Photo.Image128x128
+	}
+	userTraitOptions = append(userTraitOptions, rs.WithUserProfile(profile))
+	userTraitOptions = append(userTraitOptions, traitOptions...)
 
 	ret, err := rs.NewUserResource(
 		user.Name,
@@ -69,7 +126,89 @@ func (o *userResourceType) List(ctx context.Context, parentId *v2.ResourceId, to
 		return nil, "", nil, err
 	}
 
-	users, nextToken, _, err := o.client.GetUsers(ctx, asana.GetUsersVars{WorkspaceId: parentId.Resource, Limit: ResourcesPageSize, Offset: bag.PageToken()})
+	export, err := o.export.load(ctx, parentId.Resource)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	var workspaceMemberships []asana.WorkspaceMembership
+	var nextToken string
+	switch {
+	case export != nil && len(export.WorkspaceMemberships) > 0:
+		workspaceMemberships, nextToken, err = pageSlice(export.WorkspaceMemberships, bag.PageToken(), ResourcesPageSize)
+	case export != nil || !o.capabilities.canReadMemberships():
+		return o.listUsers(ctx, parentId, bag, export)
+	default:
+		workspaceMemberships, nextToken, _, err = o.client.GetWorkspaceMemberships(ctx, asana.GetWorkspaceMembershipsVars{
+			WorkspaceId: parentId.Resource,
+			Limit:       ResourcesPageSize,
+			Offset:      bag.PageToken(),
+		})
+	}
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	pageToken, err := bag.NextToken(nextToken)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	workspaceGuests, err := o.guests.workspace(ctx, parentId.Resource)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	o.guests.recordGuests(parentId.Resource, workspaceMemberships)
+
+	var rv []*v2.Resource
+	for _, workspaceMembership := range workspaceMemberships {
+		workspaceMembershipCopy := workspaceMembership
+		extraProfile := workspaceGuests.profile(workspaceMembership.User.Gid)
+		// SCIM records are only read when the membership lacks profile fields.
+		if workspaceMembership.Title == "" || workspaceMembership.Department == "" {
+			hrProfile, err := o.scim.profile(ctx, workspaceMembership.User.Gid)
+			if err != nil {
+				return nil, "", nil, err
+			}
+			for k, v := range hrProfile {
+				extraProfile[k] = v
+			}
+		}
+		activity, err := o.activity.member(ctx, parentId.Resource, &workspaceMembershipCopy)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		for k, v := range o.activity.metadata(activity) {
+			extraProfile[k] = v
+		}
+		var traitOptions []rs.UserTraitOption
+		if !activity.lastLogin.IsZero() {
+			traitOptions = append(traitOptions, rs.WithLastLogin(activity.lastLogin))
+		}
+		ur, err := workspaceMemberResource(&workspaceMembershipCopy, extraProfile, parentId, traitOptions...)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		rv = append(rv, ur)
+	}
+
+	return rv, pageToken, nil, nil
+}
+
+// listUsers lists the users of a workspace without their membership details,
+// for credentials that cannot read workspace memberships and for exports
+// without them. When the grants of guests are flagged, the membership of each
+// user is looked up to tell guests apart, provided the credentials can read
+// memberships.
+func (o *userResourceType) listUsers(ctx context.Context, parentId *v2.ResourceId, bag *pagination.Bag, export *asana.OrganizationExportData) ([]*v2.Resource, string, annotations.Annotations, error) {
+	var users []asana.User
+	var nextToken string
+	var err error
+	if export != nil {
+		users, nextToken, err = pageSlice(export.Users, bag.PageToken(), ResourcesPageSize)
+	} else {
+		users, nextToken, _, err = o.client.GetUsers(ctx, asana.GetUsersVars{WorkspaceId: parentId.Resource, Limit: ResourcesPageSize, Offset: bag.PageToken()})
+	}
 	if err != nil {
 		return nil, "", nil, err
 	}
@@ -79,10 +218,52 @@ func (o *userResourceType) List(ctx context.Context, parentId *v2.ResourceId, to
 		return nil, "", nil, err
 	}
 
+	workspaceGuests, err := o.guests.workspace(ctx, parentId.Resource)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	lookUpGuests := o.guests.flagsGuests() && o.capabilities.canReadMemberships()
+	if bag.PageToken() == "" {
+		l := ctxzap.Extract(ctx)
+		if o.guests.flagsGuests() && !lookUpGuests {
+			l.Warn(
+				"baton-asana: guests cannot be flagged, the credentials cannot read workspace memberships",
+				zap.String("workspace_id", parentId.Resource),
+			)
+		}
+		// Titles and departments are read from workspace memberships, so
+		// without them they are only known through SCIM.
+		if !o.capabilities.canUseScim() {
+			l.Warn(
+				"baton-asana: titles and departments are not synced, the workspace memberships and SCIM are unavailable",
+				zap.String("workspace_id", parentId.Resource),
+			)
+		}
+	}
+
 	var rv []*v2.Resource
 	for _, user := range users {
 		userCopy := user
-		ur, err := userResource(ctx, &userCopy, parentId)
+		extraProfile := workspaceGuests.profile(user.Gid)
+		if lookUpGuests {
+			workspaceMembership, err := o.client.GetWorkspaceMembership(ctx, parentId.Resource, user.Gid)
+			if err != nil {
+				return nil, "", nil, fmt.Errorf("baton-asana: failed to get the workspace membership of user %s: %w", user.Gid, err)
+			}
+			if workspaceMembership != nil {
+				o.guests.recordGuests(parentId.Resource, []asana.WorkspaceMembership{*workspaceMembership})
+				extraProfile["guest"] = workspaceMembership.IsGuest
+			}
+		}
+		hrProfile, err := o.scim.profile(ctx, user.Gid)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		for k, v := range hrProfile {
+			extraProfile[k] = v
+		}
+		ur, err := newUserResource(&userCopy, extraProfile, parentId, rs.WithStatus(v2.UserTrait_Status_STATUS_ENABLED))
 		if err != nil {
 			return nil, "", nil, err
 		}
@@ -100,9 +281,14 @@ func (o *userResourceType) Grants(_ context.Context, _ *v2.Resource, _ *paginati
 	return nil, "", nil, nil
 }
 
-func userBuilder(client *asana.Client) *userResourceType {
+func userBuilder(client *asana.Client, caps *capabilities, guests *guestDirectory, export *orgExportSource, scim *scimDirectory, activity *activityDirectory) *userResourceType {
 	return &userResourceType{
 		resourceType: resourceTypeUser,
 		client:       client,
+		capabilities: caps,
+		guests:       guests,
+		export:       export,
+		scim:         scim,
+		activity:     activity,
 	}
 }
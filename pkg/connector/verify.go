@@ -0,0 +1,39 @@
+package connector
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	// verifyAttempts bounds how often a membership is re-read after a
+	// mutation, waiting verifyInterval before the first attempt and doubling
+	// it after each, since Asana applies membership changes eventually.
+	verifyAttempts = 4
+	verifyInterval = 500 * time.Millisecond
+)
+
+// verify re-reads the state changed by a mutation until matches reports it
+// is in the requested state or the attempts run out. It reports whether the
+// state matched.
+func verify(ctx context.Context, matches func(ctx context.Context) (bool, error)) (bool, error) {
+	interval := verifyInterval
+	for attempt := 0; attempt < verifyAttempts; attempt++ {
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-time.After(interval):
+		}
+		interval *= 2
+
+		ok, err := matches(ctx)
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
@@ -0,0 +1,113 @@
+package connector
+
+import (
+	"fmt"
+
+	"github.com/conductorone/baton-asana/pkg/asana"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	ent "github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	"github.com/conductorone/baton-sdk/pkg/types/grant"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// WebhookChange is what a single webhook event translates to: an event
+// describing a granted or revoked membership, a resource to resync, or both.
+type WebhookChange struct {
+	Event  *v2.Event
+	Resync *v2.ResourceId
+}
+
+// WebhookFilters returns the filters webhooks on resources of the given type
+// are registered with, so that only membership changes are delivered.
+func WebhookFilters(resourceType string) []asana.WebhookFilter {
+	switch resourceType {
+	case resourceTypeWorkspace.Id:
+		return []asana.WebhookFilter{
+			{ResourceType: resourceTypeUser.Id},
+			{ResourceType: resourceTypeTeam.Id},
+		}
+	case resourceTypeTeam.Id:
+		return []asana.WebhookFilter{
+			{ResourceType: resourceTypeUser.Id},
+		}
+	default:
+		return nil
+	}
+}
+
+// membershipEntitlements maps the resource types users can be added to onto
+// the entitlement every member is granted.
+var membershipEntitlements = map[string]string{
+	resourceTypeWorkspace.Id: member,
+	resourceTypeTeam.Id:      teamMember,
+}
+
+// syncedResourceTypes lists the resource types a webhook event can request a
+// resync of.
+var syncedResourceTypes = map[string]*v2.ResourceType{
+	resourceTypeUser.Id:      resourceTypeUser,
+	resourceTypeWorkspace.Id: resourceTypeWorkspace,
+	resourceTypeTeam.Id:      resourceTypeTeam,
+	resourceTypeProject.Id:   resourceTypeProject,
+	resourceTypePortfolio.Id: resourceTypePortfolio,
+}
+
+// WebhookChanges translates webhook events into changes. Users added to or
+// removed from a workspace or team become grant or revoke events, along with
+// a resync of the parent since the role of the user is not part of the
+// event. Any other change of a synced resource becomes a resync.
+func WebhookChanges(events []asana.WebhookEvent) []WebhookChange {
+	var rv []WebhookChange
+	for _, event := range events {
+		if change, ok := membershipChange(event); ok {
+			rv = append(rv, change)
+			continue
+		}
+
+		target := &event.Resource
+		if event.Parent != nil && event.Resource.ResourceType == resourceTypeUser.Id {
+			target = event.Parent
+		}
+		if _, ok := syncedResourceTypes[target.ResourceType]; !ok {
+			continue
+		}
+		rv = append(rv, WebhookChange{
+			Resync: &v2.ResourceId{ResourceType: target.ResourceType, Resource: target.Gid},
+		})
+	}
+
+	return rv
+}
+
+func membershipChange(event asana.WebhookEvent) (WebhookChange, bool) {
+	if event.Resource.ResourceType != resourceTypeUser.Id || event.Parent == nil {
+		return WebhookChange{}, false
+	}
+	entitlementName, ok := membershipEntitlements[event.Parent.ResourceType]
+	if !ok {
+		return WebhookChange{}, false
+	}
+
+	parent := &v2.Resource{Id: &v2.ResourceId{ResourceType: event.Parent.ResourceType, Resource: event.Parent.Gid}}
+	principal := &v2.Resource{Id: &v2.ResourceId{ResourceType: resourceTypeUser.Id, Resource: event.Resource.Gid}}
+
+	ev := &v2.Event{
+		Id:         fmt.Sprintf("%s:%s:%s:%d", event.Action, event.Parent.Gid, event.Resource.Gid, event.CreatedAt.UnixNano()),
+		OccurredAt: timestamppb.New(event.CreatedAt),
+	}
+	switch event.Action {
+	case "added":
+		ev.Event = &v2.Event_GrantEvent{GrantEvent: &v2.GrantEvent{
+			Grant: grant.NewGrant(parent, entitlementName, principal),
+		}}
+	case "removed":
+		ev.Event = &v2.Event_RevokeEvent{RevokeEvent: &v2.RevokeEvent{
+			Entitlement: &v2.Entitlement{Id: ent.NewEntitlementID(parent, entitlementName), Resource: parent},
+			Principal:   principal,
+		}}
+	default:
+		return WebhookChange{}, false
+	}
+
+	return WebhookChange{Event: ev, Resync: parent.Id}, true
+}
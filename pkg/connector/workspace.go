@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"slices"
 	"strings"
 
 	"google.golang.org/grpc/codes"
@@ -31,21 +32,61 @@ var workspaceRoles = []string{
 	guest,
 }
 
+// Seats members are billed for, derived from their workspace membership.
+// They are synced for license reviews and cannot be granted or revoked.
+const (
+	paidMemberSeat          = "Paid Member Seat"
+	limitedAccessMemberSeat = "Limited Access Member Seat"
+	guestSeat               = "Guest Seat"
+)
+
+var workspaceSeats = []string{
+	paidMemberSeat,
+	limitedAccessMemberSeat,
+	guestSeat,
+}
+
+// workspaceSeat returns the seat an active member is billed for.
+func workspaceSeat(workspaceMembership *asana.WorkspaceMembership) string {
+	switch {
+	case workspaceMembership.IsGuest:
+		return guestSeat
+	case workspaceMembership.IsViewOnly:
+		return limitedAccessMemberSeat
+	default:
+		return paidMemberSeat
+	}
+}
+
 type workspaceResourceType struct {
 	resourceType      *v2.ResourceType
 	client            *asana.Client
 	allowedWorkspaces *[]string
+	capabilities      *capabilities
+	// offboarder hands over what users own before they are removed, when
+	// offboarding is enabled.
+	offboarder *offboarder
+	// export serves workspace memberships from organization exports when
+	// bulk sync is enabled.
+	export *orgExportSource
+	// activity adds the creation, last login and dormancy of each membership
+	// to its grant.
+	activity *activityDirectory
 }
 
 func (o *workspaceResourceType) ResourceType(_ context.Context) *v2.ResourceType {
 	return o.resourceType
 }
 
-func workspaceBuilder(client *asana.Client, allowedWorkspaces *[]string) *workspaceResourceType {
+func workspaceBuilder(client *asana.Client, allowedWorkspaces *[]string, capabilities *capabilities, offboarder *offboarder, export *orgExportSource, activity *activityDirectory) *workspaceResourceType {
 	return &workspaceResourceType{
 		resourceType:      resourceTypeWorkspace,
 		client:            client,
 		allowedWorkspaces: allowedWorkspaces,
+		capabilities:      capabilities,
+		offboarder:        offboarder,
+		export:            export,
+		activity:          activity,
 	}
 }
 
@@ -63,6 +104,10 @@ func workspaceResource(ctx context.Context, workspace asana.Workspace) (*v2.Reso
 		rs.WithAnnotation(
 			&v2.ChildResourceType{ResourceTypeId: resourceTypeUser.Id},
 			&v2.ChildResourceType{ResourceTypeId: resourceTypeTeam.Id},
+			&v2.ChildResourceType{ResourceTypeId: resourceTypeProject.Id},
+			&v2.ChildResourceType{ResourceTypeId: resourceTypePortfolio.Id},
+			&v2.ChildResourceType{ResourceTypeId: resourceTypeCustomField.Id},
+			&v2.ChildResourceType{ResourceTypeId: resourceTypeProjectTemplate.Id},
 		),
 	}
 
@@ -79,12 +124,13 @@ func (o *workspaceResourceType) List(ctx context.Context, resourceId *v2.Resourc
 		return nil, "", nil, nil
 	}
 
-	rv := make([]*v2.Resource, 0, len(*o.allowedWorkspaces))
-	for _, workspaceId := range *o.allowedWorkspaces {
-		workspaceInfo, _, err := o.client.GetWorkspace(ctx, workspaceId)
-		if err != nil {
-			return nil, "", nil, err
-		}
+	workspaces, err := o.client.GetWorkspaces(ctx, *o.allowedWorkspaces)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	rv := make([]*v2.Resource, 0, len(workspaces))
+	for _, workspaceInfo := range workspaces {
 		wr, err := workspaceResource(ctx, workspaceInfo)
 		if err != nil {
 			return nil, "", nil, err
@@ -107,6 +153,16 @@ func (o *workspaceResourceType) Entitlements(ctx context.Context, resource *v2.R
 		permissionEn := ent.NewPermissionEntitlement(resource, role, permissionOptions...)
 		rv = append(rv, permissionEn)
 	}
+	for _, seat := range workspaceSeats {
+		seatOptions := []ent.EntitlementOption{
+			ent.WithGrantableTo(resourceTypeUser),
+			ent.WithDescription(fmt.Sprintf("Seat billed for in %s Asana workspace", resource.DisplayName)),
+			ent.WithDisplayName(fmt.Sprintf("%s Workspace %s", resource.DisplayName, seat)),
+			ent.WithAnnotation(&v2.EntitlementImmutable{}),
+		}
+
+		rv = append(rv, ent.NewPermissionEntitlement(resource, seat, seatOptions...))
+	}
 	return rv, "", nil, nil
 }
 
@@ -126,7 +182,18 @@ func (o *workspaceResourceType) Grants(ctx context.Context, resource *v2.Resourc
 		return nil, "", nil, fmt.Errorf("error fetching workspace_id from workspace profile")
 	}
 
-	workspaceMembership, offset, _, err := o.client.GetWorkspaceMemberships(ctx, asana.GetWorkspaceMembershipsVars{WorkspaceId: workspaceId, Limit: ResourcesPageSize, Offset: bag.PageToken()})
+	export, err := o.export.load(ctx, workspaceId)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	var workspaceMembership []asana.WorkspaceMembership
+	var offset string
+	if export != nil && len(export.WorkspaceMemberships) > 0 {
+		workspaceMembership, offset, err = pageSlice(export.WorkspaceMemberships, bag.PageToken(), ResourcesPageSize)
+	} else {
+		workspaceMembership, offset, _, err = o.client.GetWorkspaceMemberships(ctx, asana.GetWorkspaceMembershipsVars{WorkspaceId: workspaceId, Limit: ResourcesPageSize, Offset: bag.PageToken()})
+	}
 	if err != nil {
 		return nil, "", nil, err
 	}
@@ -149,13 +216,29 @@ func (o *workspaceResourceType) Grants(ctx context.Context, resource *v2.Resourc
 			roleName = guest
 		}
 		workspaceMemberCopy := workspaceMember
-		ur, err := userResource(ctx, &workspaceMemberCopy.User, resource.Id)
+		ur, err := userResource(&workspaceMemberCopy.User, resource.Id)
 		if err != nil {
 			return nil, "", nil, err
 		}
 
-		permissionGrant := grant.NewGrant(resource, roleName, ur.Id)
+		activity, err := o.activity.member(ctx, workspaceId, &workspaceMemberCopy)
+		if err != nil {
+			return nil, "", nil, err
+		}
+
+		metadata := o.activity.metadata(activity)
+
+		permissionGrant := grant.NewGrant(resource, roleName, ur.Id, grant.WithGrantMetadata(metadata))
 		rv = append(rv, permissionGrant)
+
+		// Deactivated members are not billed for a seat.
+		if workspaceMember.IsActive {
+			seatGrant := grant.NewGrant(resource, workspaceSeat(&workspaceMemberCopy), ur.Id,
+				grant.WithGrantMetadata(metadata),
+				grant.WithAnnotation(&v2.GrantImmutable{}),
+			)
+			rv = append(rv, seatGrant)
+		}
 	}
 
 	return rv, pageToken, nil, nil
@@ -163,15 +246,7 @@ func (o *workspaceResourceType) Grants(ctx context.Context, resource *v2.Resourc
 
 func (o *workspaceResourceType) Grant(ctx context.Context, resource *v2.Resource, entitlement *v2.Entitlement) ([]*v2.Grant, annotations.Annotations, error) {
 	if resource.Id.ResourceType == resourceTypeUser.Id {
-		workspaceId := entitlement.Resource.Id.Resource
-		userId := resource.Id.Resource
-
-		err := o.client.AddUserToWorkspace(ctx, workspaceId, userId)
-		if err != nil {
-			if status.Code(err) == codes.PermissionDenied {
-				return nil, nil, errors.Join(err, errors.New("user does not have permission to add user to workspace or the user was previous removed from the workspace"))
-			}
-
+		if err := o.capabilities.canProvision(); err != nil {
 			return nil, nil, err
 		}
 
@@ -179,6 +254,34 @@ func (o *workspaceResourceType) Grant(ctx context.Context, resource *v2.Resource
 		if err != nil {
 			return nil, nil, err
 		}
+		if slices.Contains(workspaceSeats, workspaceEntitlement) {
+			return nil, nil, fmt.Errorf("baton-asana: %s is derived from the workspace membership and cannot be granted", workspaceEntitlement)
+		}
+
+		workspaceId := entitlement.Resource.Id.Resource
+		userId := resource.Id.Resource
+
+		var annos annotations.Annotations
+		err = o.client.AddUserToWorkspace(ctx, workspaceId, userId)
+		switch {
+		case errors.Is(err, asana.ErrAlreadyMember):
+			annos.Update(&v2.GrantAlreadyExists{})
+		case status.Code(err) == codes.PermissionDenied:
+			return nil, nil, errors.Join(err, errors.New("user does not have permission to add user to workspace or the user was previous removed from the workspace"))
+		case err != nil:
+			return nil, nil, err
+		default:
+			added, err := verify(ctx, func(ctx context.Context) (bool, error) {
+				membership, err := o.client.GetWorkspaceMembership(ctx, workspaceId, userId)
+				return membership != nil && membership.IsActive, err
+			})
+			if err != nil {
+				return nil, nil, err
+			}
+			if !added {
+				return nil, nil, fmt.Errorf("baton-asana: user %s was added to workspace %s but is not an active member", userId, workspaceId)
+			}
+		}
 
 		userRsId, err := rs.NewResourceID(resourceTypeUser, userId)
 		if err != nil {
@@ -189,7 +292,7 @@ func (o *workspaceResourceType) Grant(ctx context.Context, resource *v2.Resource
 			grant.NewGrant(resource, workspaceEntitlement, userRsId),
 		}
 
-		return rv, nil, nil
+		return rv, annos, nil
 	}
 
 	return nil, nil, fmt.Errorf("invalid resource type %s", resource.Id.ResourceType)
@@ -197,15 +300,61 @@ func (o *workspaceResourceType) Grant(ctx context.Context, resource *v2.Resource
 
 func (o *workspaceResourceType) Revoke(ctx context.Context, grant *v2.Grant) (annotations.Annotations, error) {
 	if grant.Principal.Id.ResourceType == resourceTypeUser.Id {
+		if err := o.capabilities.canProvision(); err != nil {
+			return nil, err
+		}
+
+		workspaceEntitlement, err := getWorkspaceEntitlement(grant.Entitlement)
+		if err != nil {
+			return nil, err
+		}
+		if slices.Contains(workspaceSeats, workspaceEntitlement) {
+			return nil, fmt.Errorf("baton-asana: %s is derived from the workspace membership and cannot be revoked", workspaceEntitlement)
+		}
+
 		workspaceId := grant.Entitlement.Resource.Id.Resource
 		userId := grant.Principal.Id.Resource
 
-		err := o.client.RemoveUserToWorkspace(ctx, workspaceId, userId)
+		var annos annotations.Annotations
+		if o.offboarder != nil {
+			report, err := o.offboarder.offboard(ctx, workspaceId, userId)
+			if err != nil {
+				return nil, err
+			}
+
+			reportAnnotation, err := report.annotation()
+			if err != nil {
+				return nil, err
+			}
+			annos.Append(reportAnnotation)
+		}
+
+		report, err := deprovision(ctx, o.client, workspaceId, userId)
+		reportAnnotation, annotationErr := report.annotation()
+		if annotationErr != nil {
+			return annos, errors.Join(err, annotationErr)
+		}
+		annos.Append(reportAnnotation)
 		if err != nil {
-			return nil, err
+			return annos, err
+		}
+		if report.AlreadyRemoved {
+			annos.Update(&v2.GrantAlreadyRevoked{})
+			return annos, nil
+		}
+
+		removed, err := verify(ctx, func(ctx context.Context) (bool, error) {
+			membership, err := o.client.GetWorkspaceMembership(ctx, workspaceId, userId)
+			return membership == nil || !membership.IsActive, err
+		})
+		if err != nil {
+			return annos, err
+		}
+		if !removed {
+			return annos, fmt.Errorf("baton-asana: user %s was removed from workspace %s but is still an active member", userId, workspaceId)
 		}
 
-		return nil, nil
+		return annos, nil
 	}
 
 	return nil, fmt.Errorf("invalid resource type %s", grant.Principal.Id.ResourceType)
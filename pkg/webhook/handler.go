@@ -0,0 +1,149 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"path"
+	"sync"
+
+	"github.com/conductorone/baton-asana/pkg/asana"
+	"github.com/conductorone/baton-asana/pkg/connector"
+	"go.uber.org/zap"
+)
+
+// maxDeliverySize bounds the body of a single delivery read by the handler.
+const maxDeliverySize = 10 << 20
+
+// Handler receives the requests Asana sends to webhook targets. Each webhook
+// is served under its own path, whose last segment is the key the secret of
+// the webhook is stored under. It only accepts handshakes for keys it was told
+// to expect, and then only once, so a secret cannot be replaced by a third
+// party.
+type Handler struct {
+	logger   *zap.Logger
+	onChange func(connector.WebhookChange)
+
+	mu      sync.Mutex
+	pending map[string]bool
+	secrets map[string][]byte
+}
+
+// NewHandler returns a handler passing the changes of each verified delivery
+// to onChange.
+func NewHandler(logger *zap.Logger, onChange func(connector.WebhookChange)) *Handler {
+	return &Handler{
+		logger:   logger,
+		onChange: onChange,
+		pending:  make(map[string]bool),
+		secrets:  make(map[string][]byte),
+	}
+}
+
+// Expect allows a single handshake for key.
+func (h *Handler) Expect(key string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.pending[key] = true
+}
+
+// SetSecret stores the secret deliveries for key are signed with, e.g. for a
+// webhook established in an earlier run.
+func (h *Handler) SetSecret(key string, secret []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.pending, key)
+	h.secrets[key] = secret
+}
+
+func (h *Handler) secret(key string) ([]byte, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	secret, ok := h.secrets[key]
+	return secret, ok
+}
+
+// Sign returns the signature Asana sends along with body for a webhook
+// established with secret.
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature is the valid signature of body.
+func Verify(secret, body []byte, signature string) bool {
+	expected, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	key := path.Base(r.URL.Path)
+
+	if secret := r.Header.Get(asana.WebhookSecretHeader); secret != "" {
+		h.handshake(w, key, secret)
+		return
+	}
+
+	secret, ok := h.secret(key)
+	if !ok {
+		// Asana deletes webhooks whose target responds with 410.
+		h.logger.Warn("baton-asana: delivery for unknown webhook", zap.String("key", key))
+		w.WriteHeader(http.StatusGone)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxDeliverySize))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if !Verify(secret, body, r.Header.Get(asana.WebhookSignatureHeader)) {
+		h.logger.Warn("baton-asana: rejected delivery with invalid signature", zap.String("key", key))
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var delivery asana.WebhookDelivery
+	if err := json.Unmarshal(body, &delivery); err != nil {
+		h.logger.Warn("baton-asana: rejected malformed delivery", zap.String("key", key), zap.Error(err))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	for _, change := range connector.WebhookChanges(delivery.Events) {
+		h.onChange(change)
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *Handler) handshake(w http.ResponseWriter, key, secret string) {
+	h.mu.Lock()
+	if !h.pending[key] {
+		h.mu.Unlock()
+		h.logger.Warn("baton-asana: rejected unexpected webhook handshake", zap.String("key", key))
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	delete(h.pending, key)
+	h.secrets[key] = []byte(secret)
+	h.mu.Unlock()
+
+	w.Header().Set(asana.WebhookSecretHeader, secret)
+	w.WriteHeader(http.StatusOK)
+}
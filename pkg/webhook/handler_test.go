@@ -0,0 +1,180 @@
+package webhook
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/conductorone/baton-asana/pkg/asana"
+	"github.com/conductorone/baton-asana/pkg/connector"
+	"go.uber.org/zap"
+)
+
+const (
+	testKey    = "1201"
+	testSecret = "test-secret"
+	// testDelivery adds a user to the team of testKey.
+	testDelivery = `{"events":[{"user":{"gid":"1","resource_type":"user"},"created_at":"2024-01-02T03:04:05Z","action":"added",` +
+		`"resource":{"gid":"1301","resource_type":"user"},"parent":{"gid":"1201","resource_type":"team"}}]}`
+)
+
+// testServer serves a handler receiving the changes of verified deliveries.
+type testServer struct {
+	*httptest.Server
+	handler *Handler
+
+	mu      sync.Mutex
+	changes []connector.WebhookChange
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+
+	ts := &testServer{}
+	ts.handler = NewHandler(zap.NewNop(), func(change connector.WebhookChange) {
+		ts.mu.Lock()
+		defer ts.mu.Unlock()
+		ts.changes = append(ts.changes, change)
+	})
+	ts.Server = httptest.NewServer(ts.handler)
+	t.Cleanup(ts.Close)
+
+	return ts
+}
+
+func (ts *testServer) received() int {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	return len(ts.changes)
+}
+
+// post sends body to the webhook target of key with the given headers.
+func (ts *testServer) post(t *testing.T, key string, headers map[string]string, body string) *http.Response {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/webhooks/"+key, bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	return resp
+}
+
+func TestHandshake(t *testing.T) {
+	ts := newTestServer(t)
+	ts.handler.Expect(testKey)
+
+	resp := ts.post(t, testKey, map[string]string{asana.WebhookSecretHeader: testSecret}, "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("handshake status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	if got := resp.Header.Get(asana.WebhookSecretHeader); got != testSecret {
+		t.Fatalf("echoed secret = %q, want %q", got, testSecret)
+	}
+
+	// The secret cannot be replaced by a second handshake.
+	resp = ts.post(t, testKey, map[string]string{asana.WebhookSecretHeader: "other-secret"}, "")
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("repeated handshake status = %d, want %d", resp.StatusCode, http.StatusForbidden)
+	}
+
+	resp = ts.post(t, testKey, map[string]string{asana.WebhookSignatureHeader: Sign([]byte(testSecret), []byte(testDelivery))}, testDelivery)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("delivery status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+}
+
+func TestUnexpectedHandshake(t *testing.T) {
+	ts := newTestServer(t)
+
+	resp := ts.post(t, testKey, map[string]string{asana.WebhookSecretHeader: testSecret}, "")
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("handshake status = %d, want %d", resp.StatusCode, http.StatusForbidden)
+	}
+	if got := resp.Header.Get(asana.WebhookSecretHeader); got != "" {
+		t.Fatalf("echoed secret = %q, want none", got)
+	}
+}
+
+func TestDelivery(t *testing.T) {
+	validSignature := Sign([]byte(testSecret), []byte(testDelivery))
+
+	tests := []struct {
+		name        string
+		key         string
+		headers     map[string]string
+		body        string
+		wantStatus  int
+		wantChanges int
+	}{
+		{
+			name:        "valid signature",
+			key:         testKey,
+			headers:     map[string]string{asana.WebhookSignatureHeader: validSignature},
+			body:        testDelivery,
+			wantStatus:  http.StatusOK,
+			wantChanges: 1,
+		},
+		{
+			name:       "tampered body",
+			key:        testKey,
+			headers:    map[string]string{asana.WebhookSignatureHeader: validSignature},
+			body:       strings.Replace(testDelivery, `"added"`, `"removed"`, 1),
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "tampered signature",
+			key:        testKey,
+			headers:    map[string]string{asana.WebhookSignatureHeader: Sign([]byte("other-secret"), []byte(testDelivery))},
+			body:       testDelivery,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "malformed signature",
+			key:        testKey,
+			headers:    map[string]string{asana.WebhookSignatureHeader: "not-hex"},
+			body:       testDelivery,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "missing signature",
+			key:        testKey,
+			body:       testDelivery,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "missing secret",
+			key:        "1202",
+			headers:    map[string]string{asana.WebhookSignatureHeader: validSignature},
+			body:       testDelivery,
+			wantStatus: http.StatusGone,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t)
+			ts.handler.SetSecret(testKey, []byte(testSecret))
+
+			resp := ts.post(t, tt.key, tt.headers, tt.body)
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if got := ts.received(); got != tt.wantChanges {
+				t.Fatalf("changes = %d, want %d", got, tt.wantChanges)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/conductorone/baton-asana/pkg/asana"
+	"github.com/conductorone/baton-asana/pkg/connector"
+	"go.uber.org/zap"
+)
+
+// Registrar registers the webhooks delivering membership changes of every
+// workspace and team the client can access to a handler.
+type Registrar struct {
+	client  *asana.Client
+	handler *Handler
+	logger  *zap.Logger
+	// targetUrl is the public URL the handler is served under. Each webhook
+	// targets targetUrl followed by the gid of its resource.
+	targetUrl string
+}
+
+func NewRegistrar(client *asana.Client, handler *Handler, logger *zap.Logger, targetUrl string) *Registrar {
+	return &Registrar{
+		client:    client,
+		handler:   handler,
+		logger:    logger,
+		targetUrl: strings.TrimSuffix(targetUrl, "/"),
+	}
+}
+
+// Register replaces the webhooks previously registered for the target URL,
+// whose secrets are lost across runs, with new ones for every workspace the
+// client is a full member of and every team in them. The handler must be
+// served before calling Register, since Asana performs the handshake while
+// each webhook is created.
+func (r *Registrar) Register(ctx context.Context) (int, error) {
+	workspaceMemberships, err := r.client.AuthCheck(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	registered := 0
+	for _, workspaceMembership := range workspaceMemberships {
+		if workspaceMembership.IsGuest {
+			continue
+		}
+		workspaceId := workspaceMembership.Workspace.Gid
+
+		if err := r.deleteStale(ctx, workspaceId); err != nil {
+			return registered, err
+		}
+
+		if err := r.register(ctx, workspaceId, "workspace"); err != nil {
+			return registered, err
+		}
+		registered++
+
+		for team, err := range r.client.AllTeams(ctx, workspaceId) {
+			if err != nil {
+				return registered, err
+			}
+			if err := r.register(ctx, team.Gid, "team"); err != nil {
+				return registered, err
+			}
+			registered++
+		}
+	}
+
+	return registered, nil
+}
+
+func (r *Registrar) register(ctx context.Context, resourceId, resourceType string) error {
+	r.handler.Expect(resourceId)
+
+	webhook, err := r.client.CreateWebhook(ctx, resourceId, fmt.Sprintf("%s/%s", r.targetUrl, resourceId), connector.WebhookFilters(resourceType))
+	if err != nil {
+		return fmt.Errorf("baton-asana: failed to register webhook for %s %s: %w", resourceType, resourceId, err)
+	}
+
+	r.logger.Debug(
+		"baton-asana: registered webhook",
+		zap.String("webhook_id", webhook.Gid),
+		zap.String("resource_type", resourceType),
+		zap.String("resource_id", resourceId),
+	)
+
+	return nil
+}
+
+func (r *Registrar) deleteStale(ctx context.Context, workspaceId string) error {
+	// Collected first so the listing is not altered while it is paginated.
+	var stale []string
+	for webhook, err := range r.client.AllWebhooks(ctx, workspaceId) {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(webhook.Target, r.targetUrl+"/") {
+			stale = append(stale, webhook.Gid)
+		}
+	}
+
+	for _, webhookId := range stale {
+		if err := r.client.DeleteWebhook(ctx, webhookId); err != nil {
+			return fmt.Errorf("baton-asana: failed to delete webhook %s: %w", webhookId, err)
+		}
+	}
+
+	return nil
+}